@@ -0,0 +1,315 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// ArbitrationConfig sets how a component competes for lights that other
+// components also write, e.g. the brightness, color and mode switches that
+// discovery creates for the same bulb.
+type ArbitrationConfig struct {
+	Priority *int     `json:"priority,omitempty"` // 0-100, higher wins; default by component
+	HoldS    *float64 `json:"hold_s,omitempty"`   // how long a write keeps the light, 0 until released
+	Defer    bool     `json:"defer,omitempty"`    // apply a blocked write once the light is free instead of failing
+}
+
+// Default priorities: a mode beats a manual change. The brightness and color
+// switches of a bulb share a priority, so neither locks the other out.
+const (
+	priorityManual = 20
+	priorityMode   = 30
+	maxPriority    = 100
+)
+
+// defaultManualHold is how long a brightness or color change keeps its light
+// from lower-priority writers.
+const defaultManualHold = 5 * time.Minute
+
+// deferredTimeout bounds a deferred write once its light is free.
+const deferredTimeout = 10 * time.Second
+
+// errDeferred is wrapped by the error acquire returns when it kept a write to
+// apply once its lights are free, so SetPosition does not report it as done.
+var errDeferred = errors.New("write deferred until the lights are free")
+
+func (cfg *ArbitrationConfig) validate() error {
+	if cfg.Priority != nil && (*cfg.Priority < 0 || *cfg.Priority > maxPriority) {
+		return fmt.Errorf("arbitration priority must be 0-%d, got %d", maxPriority, *cfg.Priority)
+	}
+	if cfg.HoldS != nil && *cfg.HoldS < 0 {
+		return fmt.Errorf("arbitration hold_s must be positive, got %v", *cfg.HoldS)
+	}
+	return nil
+}
+
+// claimant is a component that takes ownership of the lights it writes. A nil
+// claimant takes part in no arbitration.
+type claimant struct {
+	name        string
+	priority    int
+	hold        time.Duration // 0 holds until released
+	deferWrites bool
+	logger      logging.Logger
+}
+
+// newClaimant applies cfg, which may be nil, over a component's defaults.
+func newClaimant(name string, cfg *ArbitrationConfig, priority int, hold time.Duration, logger logging.Logger) *claimant {
+	c := &claimant{name: name, priority: priority, hold: hold, logger: logger}
+	if cfg != nil {
+		if cfg.Priority != nil {
+			c.priority = *cfg.Priority
+		}
+		if cfg.HoldS != nil {
+			c.hold = time.Duration(*cfg.HoldS * float64(time.Second))
+		}
+		c.deferWrites = cfg.Defer
+	}
+	return c
+}
+
+// lightClaim is the component that currently owns a light.
+type lightClaim struct {
+	owner    string
+	priority int
+	until    time.Time // zero until released
+}
+
+func (l lightClaim) active(now time.Time) bool {
+	return l.until.IsZero() || now.Before(l.until)
+}
+
+var (
+	claimsMu sync.Mutex
+	claims   = map[string]lightClaim{}                // bridge/light ID -> owner
+	deferred = map[string]func(ctx context.Context){} // owner name -> its latest blocked write
+)
+
+// blockedBy returns the claim keeping c from writing a light, if any. Only a
+// higher priority blocks; a peer of equal priority takes the light over.
+// claimsMu must be held.
+func (c *claimant) blockedBy(key string, now time.Time) (lightClaim, bool) {
+	l, ok := claims[key]
+	if !ok || l.owner == c.name || !l.active(now) || l.priority <= c.priority {
+		return lightClaim{}, false
+	}
+	return l, true
+}
+
+// claim takes ownership of every light, or of none if any is held by a
+// higher-priority owner.
+func (c *claimant) claim(bridge *huego.Bridge, ids []int) error {
+	if c == nil {
+		return nil
+	}
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	now := time.Now()
+	var blocked []int
+	var holder lightClaim
+	for _, id := range ids {
+		if l, ok := c.blockedBy(commandedKey(bridge, id), now); ok {
+			blocked = append(blocked, id)
+			holder = l
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("lights %v are held by %s (priority %d, above %d)", blocked, holder.owner, holder.priority, c.priority)
+	}
+
+	var until time.Time
+	if c.hold > 0 {
+		until = now.Add(c.hold)
+	}
+	for _, id := range ids {
+		claims[commandedKey(bridge, id)] = lightClaim{owner: c.name, priority: c.priority, until: until}
+	}
+	return nil
+}
+
+// acquire claims the lights for a write and reports whether the write may go
+// ahead. When they are held and c defers writes, retry is kept to run once
+// they are free and acquire returns false with an error wrapping errDeferred;
+// each newer blocked write replaces the kept one.
+func (c *claimant) acquire(bridge *huego.Bridge, ids []int, retry func(ctx context.Context) error) (bool, error) {
+	err := c.claim(bridge, ids)
+	if err == nil {
+		return true, nil
+	}
+	if !c.deferWrites {
+		return false, err
+	}
+
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	c.logger.Infof("deferring write: %v", err)
+	deferred[c.name] = func(ctx context.Context) {
+		// a write blocked again is deferred again, not failed
+		if err := retry(ctx); err != nil && !errors.Is(err, errDeferred) {
+			c.logger.Warnf("deferred write failed: %v", err)
+		}
+	}
+	err = fmt.Errorf("%w: %v", errDeferred, err)
+	now := time.Now()
+	var wait time.Duration
+	for _, id := range ids {
+		if l, ok := c.blockedBy(commandedKey(bridge, id), now); ok {
+			if l.until.IsZero() {
+				return false, err // runs when the owner releases it
+			}
+			wait = max(wait, l.until.Sub(now))
+		}
+	}
+	time.AfterFunc(wait, func() { runDeferred(c.name) })
+	return false, err
+}
+
+// check returns an error if c may not write a light, for writes from
+// background loops that claimed their lights when they started.
+func (c *claimant) check(bridge *huego.Bridge, id int) error {
+	if c == nil {
+		return nil
+	}
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	if l, ok := c.blockedBy(commandedKey(bridge, id), time.Now()); ok {
+		return fmt.Errorf("light %d is held by %s (priority %d)", id, l.owner, l.priority)
+	}
+	return nil
+}
+
+// release gives up c's claim on the lights and runs any writes deferred
+// until then.
+func (c *claimant) release(bridge *huego.Bridge, ids []int) {
+	if c == nil {
+		return
+	}
+	keys := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keys[commandedKey(bridge, id)] = true
+	}
+	c.releaseWhere(func(key string) bool { return keys[key] })
+}
+
+// keep gives up c's claim on every light of the bridge not in ids.
+func (c *claimant) keep(bridge *huego.Bridge, ids []int) {
+	if c == nil {
+		return
+	}
+	prefix := bridgeKey(bridge) + "/"
+	kept := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		kept[commandedKey(bridge, id)] = true
+	}
+	c.releaseWhere(func(key string) bool { return strings.HasPrefix(key, prefix) && !kept[key] })
+}
+
+// releaseWhere gives up c's claim on every light whose key matches.
+func (c *claimant) releaseWhere(match func(key string) bool) {
+	claimsMu.Lock()
+	released := false
+	for key, l := range claims {
+		if l.owner == c.name && match(key) {
+			delete(claims, key)
+			released = true
+		}
+	}
+	var owners []string
+	if released {
+		for owner := range deferred {
+			owners = append(owners, owner)
+		}
+	}
+	claimsMu.Unlock()
+
+	// A write still blocked by another owner is deferred again.
+	for _, owner := range owners {
+		runDeferred(owner)
+	}
+}
+
+// close releases every light c holds on the bridge and drops its deferred write.
+func (c *claimant) close(bridge *huego.Bridge) {
+	if c == nil {
+		return
+	}
+	claimsMu.Lock()
+	delete(deferred, c.name)
+	claimsMu.Unlock()
+	c.keep(bridge, nil)
+}
+
+// runDeferred runs owner's deferred write, if it still has one.
+func runDeferred(owner string) {
+	claimsMu.Lock()
+	retry, ok := deferred[owner]
+	delete(deferred, owner)
+	claimsMu.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deferredTimeout)
+		defer cancel()
+		retry(ctx)
+	}()
+}
+
+type claimantKey struct{}
+
+// withClaimant marks writes made with ctx as c's, so setLightState refuses
+// lights a higher-priority owner has taken since c claimed them.
+func withClaimant(ctx context.Context, c *claimant) context.Context {
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, claimantKey{}, c)
+}
+
+func claimantFrom(ctx context.Context) *claimant {
+	c, _ := ctx.Value(claimantKey{}).(*claimant)
+	return c
+}
+
+// lightOwners reports the current owner of each light that has one, keyed by
+// light ID, for DoCommand results.
+func lightOwners(bridge *huego.Bridge, ids []int) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, id := range ids {
+		if owner := lightOwner(bridge, id); len(owner) > 0 {
+			out[fmt.Sprint(id)] = owner
+		}
+	}
+	return out
+}
+
+// lightOwner describes the light's current owner, or is empty if it is free.
+func lightOwner(bridge *huego.Bridge, id int) map[string]interface{} {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	l, ok := claims[commandedKey(bridge, id)]
+	if !ok || !l.active(time.Now()) {
+		return map[string]interface{}{}
+	}
+	owner := map[string]interface{}{"owner": l.owner, "priority": l.priority}
+	if !l.until.IsZero() {
+		owner["until"] = l.until.Format(time.RFC3339)
+	}
+	return owner
+}
+
+// deferredResult is the DoCommand result when acquire held a write back: a
+// note if it was deferred, otherwise err.
+func deferredResult(err error) (map[string]interface{}, error) {
+	if errors.Is(err, errDeferred) {
+		return map[string]interface{}{"deferred": true}, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,179 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// testBridge returns a bridge no other test shares, so package-level
+// registries keyed by bridge start empty.
+func testBridge(t *testing.T) *huego.Bridge {
+	return huego.New(fmt.Sprintf("%s.test", t.Name()), "user")
+}
+
+func TestClaimPriorities(t *testing.T) {
+	hold := func(s float64) *ArbitrationConfig { return &ArbitrationConfig{HoldS: &s} }
+	tests := []struct {
+		name          string
+		first, second func(logging.Logger) *claimant
+		secondBlocked bool
+	}{
+		{
+			"color after brightness",
+			func(l logging.Logger) *claimant {
+				return newClaimant("brightness", nil, priorityManual, defaultManualHold, l)
+			},
+			func(l logging.Logger) *claimant { return newClaimant("red", nil, priorityManual, defaultManualHold, l) },
+			false,
+		},
+		{
+			"manual after mode",
+			func(l logging.Logger) *claimant { return newClaimant("mode", nil, priorityMode, 0, l) },
+			func(l logging.Logger) *claimant {
+				return newClaimant("brightness", nil, priorityManual, defaultManualHold, l)
+			},
+			true,
+		},
+		{
+			"mode after manual",
+			func(l logging.Logger) *claimant {
+				return newClaimant("brightness", nil, priorityManual, defaultManualHold, l)
+			},
+			func(l logging.Logger) *claimant { return newClaimant("mode", nil, priorityMode, 0, l) },
+			false,
+		},
+		{
+			"lower priority during hold",
+			func(l logging.Logger) *claimant {
+				return newClaimant("brightness", nil, priorityManual, defaultManualHold, l)
+			},
+			func(l logging.Logger) *claimant {
+				p := 10
+				return newClaimant("automation", &ArbitrationConfig{Priority: &p}, priorityManual, 0, l)
+			},
+			true,
+		},
+		{
+			"lower priority after hold",
+			func(l logging.Logger) *claimant { return newClaimant("brightness", hold(0.001), priorityManual, 0, l) },
+			func(l logging.Logger) *claimant {
+				p := 10
+				return newClaimant("automation", &ArbitrationConfig{Priority: &p}, priorityManual, 0, l)
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := testBridge(t)
+			logger := logging.NewTestLogger(t)
+			first, second := tt.first(logger), tt.second(logger)
+			defer first.close(bridge)
+			defer second.close(bridge)
+
+			if err := first.claim(bridge, []int{1}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			err := second.claim(bridge, []int{1, 2})
+			if blocked := err != nil; blocked != tt.secondBlocked {
+				t.Fatalf("second claim error = %v, want blocked %v", err, tt.secondBlocked)
+			}
+			if err := second.check(bridge, 1); (err != nil) != tt.secondBlocked {
+				t.Errorf("check error = %v, want blocked %v", err, tt.secondBlocked)
+			}
+			if tt.secondBlocked && len(lightOwner(bridge, 2)) != 0 {
+				t.Error("a blocked claim took light 2")
+			}
+
+			first.release(bridge, []int{1})
+			if err := second.claim(bridge, []int{1}); err != nil {
+				t.Errorf("claim after release: %v", err)
+			}
+			if owner := lightOwner(bridge, 1)["owner"]; owner != second.name {
+				t.Errorf("owner = %v, want %s", owner, second.name)
+			}
+		})
+	}
+}
+
+func TestAcquireDefers(t *testing.T) {
+	bridge := testBridge(t)
+	logger := logging.NewTestLogger(t)
+	mode := newClaimant("mode", nil, priorityMode, 0, logger)
+	defer mode.close(bridge)
+	manual := newClaimant("brightness", &ArbitrationConfig{Defer: true}, priorityManual, defaultManualHold, logger)
+	defer manual.close(bridge)
+
+	if err := mode.claim(bridge, []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		ok, err := manual.acquire(bridge, []int{1}, func(ctx context.Context) error {
+			ran <- i
+			return nil
+		})
+		if ok || !errors.Is(err, errDeferred) {
+			t.Fatalf("acquire = %v, %v, want a deferred write", ok, err)
+		}
+	}
+
+	mode.keep(bridge, nil)
+	select {
+	case i := <-ran:
+		if i != 2 {
+			t.Errorf("deferred write %d ran, want only the newest", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deferred write did not run once the light was released")
+	}
+	select {
+	case i := <-ran:
+		t.Errorf("deferred write %d ran as well", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestKeepReleasesOthers(t *testing.T) {
+	bridge := testBridge(t)
+	c := newClaimant("mode", nil, priorityMode, 0, logging.NewTestLogger(t))
+	defer c.close(bridge)
+	if err := c.claim(bridge, []int{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	c.keep(bridge, []int{2})
+	owners := lightOwners(bridge, []int{1, 2, 3})
+	if len(owners) != 1 || owners["2"] == nil {
+		t.Errorf("owners after keep = %v, want only light 2", owners)
+	}
+}
+
+func TestDeferredResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		deferred bool
+	}{
+		{"deferred", fmt.Errorf("%w: held", errDeferred), true},
+		{"rejected", errors.New("held"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := deferredResult(tt.err)
+			if tt.deferred {
+				if err != nil || res["deferred"] != true {
+					t.Errorf("deferredResult = %v, %v, want deferred", res, err)
+				}
+			} else if err == nil {
+				t.Errorf("deferredResult = %v, want the error", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package hue
+
+import (
+	"fmt"
+	"math"
+)
+
+// BrightnessCurve maps slider positions to light output, so equal steps along
+// the slider can look like equal steps in brightness.
+type BrightnessCurve struct {
+	Type  string    `json:"type"`            // "linear" (default), "gamma", "cie" or "lut"
+	Gamma float64   `json:"gamma,omitempty"` // for "gamma", default 2.2
+	Table []float64 `json:"table,omitempty"` // for "lut": brightness percent at evenly spaced slider points
+}
+
+const defaultBrightnessGamma = 2.2
+
+func (c *BrightnessCurve) validate() error {
+	switch c.Type {
+	case "", "linear", "cie":
+	case "gamma":
+		if c.Gamma < 0 {
+			return fmt.Errorf("brightness_curve gamma must be positive, got %v", c.Gamma)
+		}
+	case "lut":
+		if len(c.Table) < 2 {
+			return fmt.Errorf("brightness_curve table needs at least two values")
+		}
+		for i, v := range c.Table {
+			if v < 0 || v > 100 {
+				return fmt.Errorf("brightness_curve table value %d must be 0-100, got %v", i, v)
+			}
+			if i > 0 && v < c.Table[i-1] {
+				return fmt.Errorf("brightness_curve table must not decrease, value %d is %v after %v", i, v, c.Table[i-1])
+			}
+		}
+	default:
+		return fmt.Errorf("brightness_curve type must be \"linear\", \"gamma\", \"cie\" or \"lut\", got %q", c.Type)
+	}
+	return nil
+}
+
+// apply maps a slider level in [0, 1] to a light output in [0, 1]. A nil
+// curve is linear.
+func (c *BrightnessCurve) apply(t float64) float64 {
+	t = math.Max(0, math.Min(1, t))
+	if c == nil {
+		return t
+	}
+	switch c.Type {
+	case "gamma":
+		g := c.Gamma
+		if g == 0 {
+			g = defaultBrightnessGamma
+		}
+		return math.Pow(t, g)
+	case "cie":
+		// CIE 1976 L*: the slider is perceived lightness, the output luminance.
+		l := t * 100
+		if l > 8 {
+			return math.Pow((l+16)/116, 3)
+		}
+		return l / 903.3
+	case "lut":
+		pos := t * float64(len(c.Table)-1)
+		i := min(int(pos), len(c.Table)-2)
+		return lerp(c.Table[i], c.Table[i+1], pos-float64(i)) / 100
+	}
+	return t
+}
@@ -0,0 +1,39 @@
+package hue
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBrightnessCurveApply(t *testing.T) {
+	lut := &BrightnessCurve{Type: "lut", Table: []float64{0, 10, 100}}
+	tests := []struct {
+		name  string
+		curve *BrightnessCurve
+		in    float64
+		want  float64
+	}{
+		{"nil is linear", nil, 0.3, 0.3},
+		{"linear", &BrightnessCurve{Type: "linear"}, 0.7, 0.7},
+		{"clamped below", &BrightnessCurve{}, -1, 0},
+		{"clamped above", &BrightnessCurve{}, 2, 1},
+		{"gamma default", &BrightnessCurve{Type: "gamma"}, 0.5, math.Pow(0.5, 2.2)},
+		{"gamma", &BrightnessCurve{Type: "gamma", Gamma: 2}, 0.5, 0.25},
+		{"gamma top", &BrightnessCurve{Type: "gamma", Gamma: 3}, 1, 1},
+		{"cie bottom", &BrightnessCurve{Type: "cie"}, 0, 0},
+		{"cie dark", &BrightnessCurve{Type: "cie"}, 0.05, 5 / 903.3},
+		{"cie middle", &BrightnessCurve{Type: "cie"}, 0.5, 0.1842},
+		{"cie top", &BrightnessCurve{Type: "cie"}, 1, 1},
+		{"lut first point", lut, 0, 0},
+		{"lut between points", lut, 0.25, 0.05},
+		{"lut middle point", lut, 0.5, 0.1},
+		{"lut last point", lut, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.curve.apply(tt.in); math.Abs(got-tt.want) > 1e-3 {
+				t.Errorf("apply(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package hue
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/amimof/huego"
+)
+
+// lightCaps is what a light can do, derived from its v1 type.
+type lightCaps struct {
+	color bool // xy and hue/sat
+	ct    bool // color temperature
+	dim   bool // brightness
+}
+
+var fullCaps = lightCaps{color: true, ct: true, dim: true}
+
+// capsForType maps a v1 light type such as "Extended color light" to its
+// capabilities. Unknown types are assumed to support everything, so new
+// bulbs are not held back.
+func capsForType(t string) lightCaps {
+	switch strings.ToLower(t) {
+	case "extended color light":
+		return fullCaps
+	case "color light":
+		return lightCaps{color: true, dim: true}
+	case "color temperature light":
+		return lightCaps{ct: true, dim: true}
+	case "dimmable light", "dimmable plug-in unit":
+		return lightCaps{dim: true}
+	case "on/off light", "on/off plug-in unit":
+		return lightCaps{}
+	}
+	return fullCaps
+}
+
+// capsFor returns the capabilities of each light, reading light types from
+// the bridge the first time a light is seen. If the bridge cannot be read the
+// lights are treated as fully capable. s.mu must be held.
+func (s *hueLightMode) capsFor(ctx context.Context, ids []int) map[int]lightCaps {
+	missing := false
+	for _, id := range ids {
+		if _, ok := s.caps[id]; !ok {
+			missing = true
+			break
+		}
+	}
+	if missing {
+		lights, err := s.bridge.GetLightsContext(ctx)
+		if err != nil {
+			s.logger.Debugf("failed to read light types, assuming full color: %v", err)
+		}
+		for i := range lights {
+			s.caps[lights[i].ID] = capsForType(lights[i].Type)
+		}
+	}
+
+	out := make(map[int]lightCaps, len(ids))
+	for _, id := range ids {
+		c, ok := s.caps[id]
+		if !ok {
+			c = fullCaps
+		}
+		out[id] = c
+	}
+	return out
+}
+
+// adaptState turns a state into the closest one the light supports: color as
+// the nearest white on ambiance bulbs, white as a color on color-only bulbs,
+// and unsupported fields dropped. The note describes what changed, or is
+// empty when the light supports the state as is.
+func adaptState(state huego.State, caps lightCaps) (huego.State, string) {
+	var notes []string
+	hasColor := len(state.Xy) == 2 || state.Hue != 0 || state.Sat != 0
+
+	if !caps.color && hasColor {
+		if caps.ct && len(state.Xy) == 2 {
+			state.Ct = xyToCt(state.Xy)
+			notes = append(notes, "color shown as nearest white")
+		} else {
+			notes = append(notes, "color not supported")
+		}
+		state.Xy, state.Hue, state.Sat = nil, 0, 0
+	}
+	if !caps.ct && state.Ct != 0 {
+		if caps.color {
+			state.Xy = ctToXy(state.Ct)
+			notes = append(notes, "white shown as color")
+		} else {
+			notes = append(notes, "color temperature not supported")
+		}
+		state.Ct = 0
+	}
+	if !caps.color && state.Effect == "colorloop" {
+		state.Effect = ""
+		notes = append(notes, "colorloop not supported")
+	}
+	if !caps.dim && state.Bri != 0 {
+		state.Bri = 0
+		notes = append(notes, "brightness not supported")
+	}
+	return state, strings.Join(notes, "; ")
+}
+
+// xyToCt returns the color temperature, within the range every ambiance bulb
+// supports, whose white is closest to an xy color. Formulas like McCamy's only
+// hold near the white locus, while saturated colors are common here.
+func xyToCt(xy []float32) uint16 {
+	best, bestDist := uint16(maxCommonCt), math.Inf(1)
+	for m := uint16(153); m <= maxCommonCt; m++ {
+		w := ctToXy(m)
+		dx, dy := float64(xy[0]-w[0]), float64(xy[1]-w[1])
+		if d := dx*dx + dy*dy; d < bestDist {
+			best, bestDist = m, d
+		}
+	}
+	return best
+}
+
+// ctToXy returns the xy point on the Planckian locus for a color temperature
+// in mireds, using the Kim et al. cubic approximation (1667-25000 K).
+func ctToXy(mireds uint16) []float32 {
+	t := math.Max(1667, math.Min(25000, 1e6/float64(mireds)))
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return []float32{float32(x), float32(y)}
+}
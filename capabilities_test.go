@@ -0,0 +1,70 @@
+package hue
+
+import (
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func TestCapsForType(t *testing.T) {
+	tests := []struct {
+		typ  string
+		want lightCaps
+	}{
+		{"Extended color light", fullCaps},
+		{"Color light", lightCaps{color: true, dim: true}},
+		{"Color temperature light", lightCaps{ct: true, dim: true}},
+		{"Dimmable light", lightCaps{dim: true}},
+		{"On/Off plug-in unit", lightCaps{}},
+		{"Hologram", fullCaps},
+	}
+	for _, tt := range tests {
+		if got := capsForType(tt.typ); got != tt.want {
+			t.Errorf("capsForType(%q) = %+v, want %+v", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptState(t *testing.T) {
+	red := []float32{0.675, 0.322}
+	tests := []struct {
+		name     string
+		state    huego.State
+		caps     lightCaps
+		wantNote string
+		check    func(huego.State) bool
+	}{
+		{"full color unchanged", huego.State{On: true, Bri: 100, Xy: red}, fullCaps, "",
+			func(s huego.State) bool { return len(s.Xy) == 2 && s.Bri == 100 }},
+		{"color on ambiance", huego.State{On: true, Xy: red}, lightCaps{ct: true, dim: true}, "color shown as nearest white",
+			func(s huego.State) bool { return s.Xy == nil && s.Ct == maxCommonCt }},
+		{"hue on ambiance", huego.State{On: true, Hue: 1000, Sat: 254}, lightCaps{ct: true, dim: true}, "color not supported",
+			func(s huego.State) bool { return s.Hue == 0 && s.Sat == 0 && s.Ct == 0 }},
+		{"white on color only", huego.State{On: true, Ct: 300}, lightCaps{color: true, dim: true}, "white shown as color",
+			func(s huego.State) bool { return s.Ct == 0 && len(s.Xy) == 2 }},
+		{"dimmable", huego.State{On: true, Bri: 50, Ct: 300, Effect: "colorloop"}, lightCaps{dim: true},
+			"color temperature not supported; colorloop not supported",
+			func(s huego.State) bool { return s.Ct == 0 && s.Effect == "" && s.Bri == 50 }},
+		{"on/off", huego.State{On: true, Bri: 50}, lightCaps{}, "brightness not supported",
+			func(s huego.State) bool { return s.On && s.Bri == 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, note := adaptState(tt.state, tt.caps)
+			if note != tt.wantNote {
+				t.Errorf("note = %q, want %q", note, tt.wantNote)
+			}
+			if !tt.check(got) {
+				t.Errorf("adaptState = %+v", got)
+			}
+		})
+	}
+}
+
+func TestCtXyRoundTrip(t *testing.T) {
+	for _, ct := range []uint16{153, 250, 370, maxCommonCt} {
+		if got := xyToCt(ctToXy(ct)); got != ct {
+			t.Errorf("xyToCt(ctToXy(%d)) = %d", ct, got)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// CircadianConfig describes a mode that keeps adjusting brightness and color
+// temperature through the day, following either the sun at a location or a
+// fixed daily curve.
+type CircadianConfig struct {
+	Latitude      *float64         `json:"latitude,omitempty"`  // degrees, north positive
+	Longitude     *float64         `json:"longitude,omitempty"` // degrees, east positive
+	Curve         []CircadianPoint `json:"curve,omitempty"`     // used instead of latitude/longitude
+	Timezone      string           `json:"timezone,omitempty"`  // IANA name for curve times, default the machine's zone
+	MinBrightness float64          `json:"min_brightness,omitempty"`
+	MaxBrightness float64          `json:"max_brightness,omitempty"`
+	WarmestCt     uint16           `json:"warmest_ct,omitempty"`
+	CoolestCt     uint16           `json:"coolest_ct,omitempty"`
+	IntervalS     float64          `json:"interval_s,omitempty"`
+	TransitionMs  *int             `json:"transition_ms,omitempty"`
+}
+
+// CircadianPoint is the light at one time of day on a circadian curve. The
+// curve is interpolated linearly between points and wraps around midnight.
+type CircadianPoint struct {
+	Time       string  `json:"time"`       // "HH:MM"
+	Brightness float64 `json:"brightness"` // percent
+	Ct         uint16  `json:"ct"`         // mireds
+}
+
+const (
+	defaultCircadianMinBri    = 20
+	defaultCircadianMaxBri    = 100
+	defaultCircadianWarmestCt = 454 // 2200 K
+	defaultCircadianCoolestCt = 182 // 5500 K
+	defaultCircadianInterval  = 60 * time.Second
+	minCircadianInterval      = 10 * time.Second
+	defaultCircadianFadeMs    = 4000
+
+	// Tolerances when comparing a light's state with what was last sent, since
+	// the bridge rounds some values.
+	manualBriTolerance = 2
+	manualCtTolerance  = 5
+)
+
+func (cfg *CircadianConfig) validate() error {
+	hasLocation := cfg.Latitude != nil || cfg.Longitude != nil
+	if hasLocation == (len(cfg.Curve) > 0) {
+		return fmt.Errorf("circadian needs either latitude and longitude or a curve")
+	}
+	if hasLocation {
+		if cfg.Latitude == nil || cfg.Longitude == nil {
+			return fmt.Errorf("circadian needs both latitude and longitude")
+		}
+		if math.Abs(*cfg.Latitude) > 90 || math.Abs(*cfg.Longitude) > 180 {
+			return fmt.Errorf("invalid circadian location %v, %v", *cfg.Latitude, *cfg.Longitude)
+		}
+	}
+	if _, err := cfg.curve(); err != nil {
+		return err
+	}
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			return fmt.Errorf("invalid circadian timezone: %w", err)
+		}
+	}
+
+	for _, b := range []float64{cfg.MinBrightness, cfg.MaxBrightness} {
+		if b < 0 || b > 100 {
+			return fmt.Errorf("circadian brightness must be 1-100, got %v", b)
+		}
+	}
+	for _, ct := range []uint16{cfg.WarmestCt, cfg.CoolestCt} {
+		if ct != 0 && (ct < 153 || ct > maxCommonCt) {
+			return fmt.Errorf("circadian ct must be 153-%d mireds, got %d", maxCommonCt, ct)
+		}
+	}
+	if cfg.IntervalS != 0 && time.Duration(cfg.IntervalS*float64(time.Second)) < minCircadianInterval {
+		return fmt.Errorf("interval_s must be at least %v", minCircadianInterval.Seconds())
+	}
+	if cfg.TransitionMs != nil {
+		if *cfg.TransitionMs < 0 {
+			return fmt.Errorf("transition_ms must be positive, got %d", *cfg.TransitionMs)
+		}
+		if time.Duration(*cfg.TransitionMs)*time.Millisecond >= cfg.interval() {
+			return fmt.Errorf("transition_ms must be shorter than interval_s")
+		}
+	}
+	return nil
+}
+
+func (cfg *CircadianConfig) interval() time.Duration {
+	if cfg.IntervalS == 0 {
+		return defaultCircadianInterval
+	}
+	return time.Duration(cfg.IntervalS * float64(time.Second))
+}
+
+// curvePoint is a CircadianPoint with its time parsed to minutes after midnight.
+type curvePoint struct {
+	minute float64
+	bri    float64
+	ct     float64
+}
+
+// curve parses and sorts the configured curve.
+func (cfg *CircadianConfig) curve() ([]curvePoint, error) {
+	points := make([]curvePoint, 0, len(cfg.Curve))
+	for i, p := range cfg.Curve {
+		t, err := time.Parse("15:04", p.Time)
+		if err != nil {
+			return nil, fmt.Errorf("curve point %d: time must be HH:MM, got %q", i, p.Time)
+		}
+		if p.Brightness < 1 || p.Brightness > 100 {
+			return nil, fmt.Errorf("curve point %d: brightness must be 1-100, got %v", i, p.Brightness)
+		}
+		if p.Ct < 153 || p.Ct > maxCommonCt {
+			return nil, fmt.Errorf("curve point %d: ct must be 153-%d mireds, got %d", i, maxCommonCt, p.Ct)
+		}
+		points = append(points, curvePoint{
+			minute: float64(t.Hour()*60 + t.Minute()),
+			bri:    p.Brightness,
+			ct:     float64(p.Ct),
+		})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].minute < points[j].minute })
+	for i := 1; i < len(points); i++ {
+		if points[i].minute == points[i-1].minute {
+			m := int(points[i].minute)
+			return nil, fmt.Errorf("curve has two points at %02d:%02d", m/60, m%60)
+		}
+	}
+	return points, nil
+}
+
+// curveAt interpolates the curve at a number of minutes after midnight.
+func curveAt(points []curvePoint, minute float64) (bri, ct float64) {
+	const day = 24 * 60
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		end := b.minute
+		if end <= a.minute {
+			end += day // the segment wrapping past midnight
+		}
+		m := minute
+		if m < a.minute {
+			m += day
+		}
+		if m >= a.minute && m < end {
+			t := (m - a.minute) / (end - a.minute)
+			return lerp(a.bri, b.bri, t), lerp(a.ct, b.ct, t)
+		}
+	}
+	return points[0].bri, points[0].ct
+}
+
+// circadianTarget is what a light was last set to, used to notice when
+// someone else has changed it.
+type circadianTarget struct {
+	bri uint8
+	ct  uint16 // 0 for lights without color temperature
+}
+
+// circadian is a compiled CircadianConfig bound to a set of lights. Lights
+// that are changed by anything else are paused until resumed.
+type circadian struct {
+	lights       []int
+	lat, lon     *float64
+	curve        []curvePoint
+	loc          *time.Location
+	minBri       float64
+	maxBri       float64
+	warmCt       float64
+	coolCt       float64
+	interval     time.Duration
+	transitionMs int
+
+	mu     sync.Mutex
+	sent   map[int]circadianTarget
+	paused map[int]bool
+	bri    float64
+	ct     float64
+}
+
+func newCircadian(cfg *CircadianConfig, lights []int) (*circadian, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(lights) == 0 {
+		return nil, fmt.Errorf("circadian needs at least one light")
+	}
+	curve, _ := cfg.curve()
+	c := &circadian{
+		lights:       lights,
+		lat:          cfg.Latitude,
+		lon:          cfg.Longitude,
+		curve:        curve,
+		loc:          time.Local,
+		minBri:       defaultCircadianMinBri,
+		maxBri:       defaultCircadianMaxBri,
+		warmCt:       defaultCircadianWarmestCt,
+		coolCt:       defaultCircadianCoolestCt,
+		interval:     cfg.interval(),
+		transitionMs: defaultCircadianFadeMs,
+		sent:         map[int]circadianTarget{},
+		paused:       map[int]bool{},
+	}
+	if cfg.Timezone != "" {
+		c.loc, _ = time.LoadLocation(cfg.Timezone)
+	}
+	if cfg.MinBrightness > 0 {
+		c.minBri = cfg.MinBrightness
+	}
+	if cfg.MaxBrightness > 0 {
+		c.maxBri = cfg.MaxBrightness
+	}
+	if cfg.WarmestCt > 0 {
+		c.warmCt = float64(cfg.WarmestCt)
+	}
+	if cfg.CoolestCt > 0 {
+		c.coolCt = float64(cfg.CoolestCt)
+	}
+	if cfg.TransitionMs != nil {
+		c.transitionMs = *cfg.TransitionMs
+	}
+	return c, nil
+}
+
+// targetAt returns the brightness percent and color temperature for a time.
+func (c *circadian) targetAt(t time.Time) (bri, ct float64) {
+	t = t.In(c.loc)
+	if len(c.curve) > 0 {
+		return curveAt(c.curve, float64(t.Hour()*60+t.Minute())+float64(t.Second())/60)
+	}
+	f := sunFactor(t, *c.lat, *c.lon)
+	return lerp(c.minBri, c.maxBri, f), lerp(c.warmCt, c.coolCt, f)
+}
+
+func (c *circadian) category() string       { return "circadian" }
+func (c *circadian) name() string           { return "circadian" }
+func (c *circadian) lightIDs() []int        { return c.lights }
+func (c *circadian) timeout() time.Duration { return 0 }
+
+func (c *circadian) status() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paused := []int{}
+	for id := range c.paused {
+		paused = append(paused, id)
+	}
+	sort.Ints(paused)
+	out := map[string]interface{}{
+		"brightness": c.bri,
+		"ct":         c.ct,
+		"paused":     intsToInterfaces(paused),
+	}
+	if c.lat != nil {
+		rise, set := sunTimes(time.Now().In(c.loc), *c.lat, *c.lon)
+		out["sunrise"] = rise.Format(time.RFC3339)
+		out["sunset"] = set.Format(time.RFC3339)
+	}
+	return out
+}
+
+// resume clears the pause on the given lights, or all lights if ids is empty,
+// and returns the lights that were resumed. They are set to the current
+// target, and turned on, at the next update.
+func (c *circadian) resume(ids []int) []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(ids) == 0 {
+		ids = c.lights
+	}
+	resumed := []int{}
+	for _, id := range ids {
+		if c.paused[id] {
+			delete(c.paused, id)
+			delete(c.sent, id)
+			resumed = append(resumed, id)
+		}
+	}
+	return resumed
+}
+
+// manuallyChanged reports whether a light no longer matches what was last
+// sent to it.
+func manuallyChanged(sent circadianTarget, state *huego.State) bool {
+	if !state.On {
+		return true
+	}
+	if math.Abs(float64(state.Bri)-float64(sent.bri)) > manualBriTolerance {
+		return true
+	}
+	if sent.ct != 0 && (state.ColorMode != "ct" || math.Abs(float64(state.Ct)-float64(sent.ct)) > manualCtTolerance) {
+		return true
+	}
+	return false
+}
+
+func (c *circadian) run(ctx context.Context, bridge *huego.Bridge, logger logging.Logger) {
+	for {
+		c.update(ctx, bridge, logger)
+		if sleepCtx(ctx, c.interval) != nil {
+			return
+		}
+	}
+}
+
+// update reads every light once, pauses any that were changed since the last
+// update, and moves the rest to the current target.
+func (c *circadian) update(ctx context.Context, bridge *huego.Bridge, logger logging.Logger) {
+	briPct, ctF := c.targetAt(time.Now())
+	target := circadianTarget{bri: percentToBri(briPct), ct: uint16(math.Round(ctF))}
+
+	lights, err := bridge.GetLightsContext(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Debugf("circadian: failed to read lights: %v", err)
+		}
+		return
+	}
+	states := make(map[int]*huego.State, len(lights))
+	for i := range lights {
+		states[lights[i].ID] = lights[i].State
+	}
+
+	type write struct {
+		id    int
+		first bool
+		t     circadianTarget
+	}
+	var writes []write
+
+	c.mu.Lock()
+	c.bri, c.ct = briPct, ctF
+	for _, id := range c.lights {
+		state, ok := states[id]
+		if !ok || state == nil || c.paused[id] {
+			continue
+		}
+		t := target
+		if state.ColorMode == "" {
+			t.ct = 0 // dimmable only
+		}
+		// Aim for what the light's limits allow, so a capped light is not
+		// mistaken for one changed by hand.
+		limited := limitedState(bridge, id, huego.State{On: true, Bri: t.bri, Ct: t.ct})
+		t.bri, t.ct = limited.Bri, limited.Ct
+		sent, ok := c.sent[id]
+		if ok && manuallyChanged(sent, state) {
+			logger.Infof("circadian: light %d was changed outside the mode, pausing it", id)
+			c.paused[id] = true
+			continue
+		}
+		if !ok || sent != t {
+			writes = append(writes, write{id: id, first: !ok, t: t})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, w := range writes {
+		var err error
+		if w.first {
+			err = setLightState(ctx, bridge, w.id, huego.State{On: true, Bri: w.t.bri, Ct: w.t.ct, Effect: "none"}, c.transitionMs)
+		} else {
+			// The next update pauses a light switched off since the read.
+			err = setLightLevels(ctx, bridge, w.id, huego.State{Bri: w.t.bri, Ct: w.t.ct}, c.transitionMs)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Debugf("circadian: failed to update light %d: %v", w.id, err)
+			continue
+		}
+		c.mu.Lock()
+		c.sent[w.id] = w.t
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,83 @@
+package hue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+func TestCircadianUpdateWrites(t *testing.T) {
+	fade := 4000
+	cfg := &CircadianConfig{
+		Curve: []CircadianPoint{
+			{Time: "00:00", Brightness: 50, Ct: 300},
+			{Time: "12:00", Brightness: 50, Ct: 300},
+		},
+		TransitionMs: &fade,
+	}
+	tests := []struct {
+		name    string
+		sent    bool             // whether the light was already updated once
+		limits  *LightLimits     // limits on the light, if any
+		owner   *claimant        // a claim held on the light, if any
+		wantOn  bool             // whether the write carries "on"
+		want    *circadianTarget // nil when nothing should be written
+		command uint8            // commanded brightness afterwards
+	}{
+		{"first update turns the light on", false, nil, nil, true, &circadianTarget{bri: percentToBri(50), ct: 300}, percentToBri(50)},
+		{"later update leaves on out", true, nil, nil, false, &circadianTarget{bri: percentToBri(50), ct: 300}, percentToBri(50)},
+		{"later update is limited", true, &LightLimits{MaxBrightness: 40}, nil, false, &circadianTarget{bri: percentToBri(40), ct: 300}, percentToBri(40)},
+		{"later update skips a held light", true, nil,
+			newClaimant("red", nil, priorityManual+50, defaultManualHold, logging.NewTestLogger(t)), false, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, map[string]interface{}{"on": true, "bri": 100, "colormode": "ct", "ct": 250})
+			logger := logging.NewTestLogger(t)
+			c, err := newCircadian(cfg, []int{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sent {
+				c.sent[1] = circadianTarget{bri: 100, ct: 250}
+			}
+			if tt.limits != nil {
+				registerLimits(f.Bridge, "limits", []int{1}, tt.limits, logger)
+			}
+			if tt.owner != nil {
+				if err := tt.owner.claim(f.Bridge, []int{1}); err != nil {
+					t.Fatal(err)
+				}
+				defer tt.owner.close(f.Bridge)
+			}
+			circ := newClaimant("mode", nil, priorityMode, 0, logger)
+			defer circ.close(f.Bridge)
+			c.update(withClaimant(context.Background(), circ), f.Bridge, logger)
+
+			writes := f.writes("/lights/1/state")
+			if tt.want == nil {
+				if len(writes) != 0 {
+					t.Fatalf("wrote %v to a held light", writes)
+				}
+				return
+			}
+			if len(writes) != 1 {
+				t.Fatalf("got %d writes, want 1", len(writes))
+			}
+			body := writes[0].body
+			if _, ok := body["on"]; ok != tt.wantOn {
+				t.Errorf("write %v: has on = %v, want %v", body, ok, tt.wantOn)
+			}
+			if body["bri"] != float64(tt.want.bri) || body["ct"] != float64(tt.want.ct) || body["transitiontime"] != 40.0 {
+				t.Errorf("write %v, want bri %d ct %d transitiontime 40", body, tt.want.bri, tt.want.ct)
+			}
+			got := effectiveState(f.Bridge, 1, &huego.State{On: true})
+			if got.Bri != tt.command {
+				t.Errorf("commanded bri = %d, want %d", got.Bri, tt.command)
+			}
+		})
+	}
+}
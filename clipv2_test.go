@@ -0,0 +1,145 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeClipV2 serves canned v2 responses over TLS and records the bodies of
+// the writes it receives.
+type fakeClipV2 struct {
+	server *httptest.Server
+	status int
+	reply  string
+
+	mu     sync.Mutex
+	writes []map[string]interface{}
+}
+
+func newFakeClipV2(t *testing.T, status int, reply string) *fakeClipV2 {
+	f := &fakeClipV2{status: status, reply: reply}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("hue-application-key") != "user" {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"errors":[{"description":"unauthorized user"}],"data":[]}`)
+			return
+		}
+		if r.Method == http.MethodPut {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			f.mu.Lock()
+			f.writes = append(f.writes, body)
+			f.mu.Unlock()
+		}
+		w.WriteHeader(f.status)
+		io.WriteString(w, f.reply)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeClipV2) client() *clipV2Client {
+	return newClipV2Client(f.server.URL, "user")
+}
+
+func TestClipV2Do(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		wantErr string
+		want    string // v1 ID of the light found
+	}{
+		{"found", http.StatusOK, `{"errors":[],"data":[{"id":"a","id_v1":"/lights/2"},{"id":"b","id_v1":"/lights/1"}]}`, "", "b"},
+		{"not found", http.StatusOK, `{"errors":[],"data":[{"id":"a","id_v1":"/lights/2"}]}`, "no v2 light resource found for light 1", ""},
+		{"bridge errors", http.StatusOK, `{"errors":[{"description":"one"},{"description":"two"}],"data":[]}`, "bridge v2 error: one; two", ""},
+		{"bad status", http.StatusServiceUnavailable, `{"errors":[],"data":[]}`, "503", ""},
+		{"bad json", http.StatusOK, `<html>`, "bad v2 response from bridge", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeClipV2(t, tt.status, tt.reply)
+			light, err := f.client().findLightByV1ID(context.Background(), 1)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if light.ID != tt.want {
+				t.Errorf("found light %q, want %q", light.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipV2ClientsShareTransport(t *testing.T) {
+	a := newClipV2Client("http://10.0.0.2/", "user")
+	b := newClipV2Client("10.0.0.3", "user")
+	if a.host != "10.0.0.2" {
+		t.Errorf("host = %q, want 10.0.0.2", a.host)
+	}
+	if a.client != b.client {
+		t.Error("each client has its own HTTP client, leaking idle connections")
+	}
+}
+
+func TestSetGradient(t *testing.T) {
+	tests := []struct {
+		name       string
+		arg        interface{}
+		wantErr    string
+		wantPoints int
+		wantMode   string
+	}{
+		{"named", "sunset", "", 5, ""},
+		{"list", []interface{}{"#ff0000", []interface{}{0.0, 0.0, 255.0}, map[string]interface{}{"x": 0.3, "y": 0.3}}, "", 3, ""},
+		{"map with mode", map[string]interface{}{"colors": []interface{}{"#ff0000", "#0000ff"}, "mode": "interpolated_palette"}, "", 2, "interpolated_palette"},
+		{"map with name", map[string]interface{}{"name": "ocean"}, "", 5, ""},
+		{"unknown name", "plaid", "unknown gradient", 0, ""},
+		{"map without colors", map[string]interface{}{"mode": "random_pixelated"}, "needs \"name\" or \"colors\"", 0, ""},
+		{"one color", []interface{}{"#ff0000"}, "at least 2 colors", 0, ""},
+		{"too many colors", []interface{}{"#000001", "#000002", "#000003", "#000004", "#000005", "#000006"}, "at most 5 gradient points", 0, ""},
+		{"bad color", []interface{}{"#ff0000", "teal-ish"}, "gradient color 1", 0, ""},
+		{"bad type", 7.0, "expects a gradient name", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeClipV2(t, http.StatusOK, `{"errors":[],"data":[]}`)
+			s := &hueGradient{cfg: &GradientConfig{LightID: 1}, v2: f.client(), v2ID: "abc", points: defaultGradientPoints}
+			err := s.setGradient(context.Background(), tt.arg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				if len(f.writes) != 0 {
+					t.Errorf("wrote %v after an error", f.writes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.writes) != 1 {
+				t.Fatalf("got %d writes, want 1", len(f.writes))
+			}
+			gradient, _ := f.writes[0]["gradient"].(map[string]interface{})
+			points, _ := gradient["points"].([]interface{})
+			if len(points) != tt.wantPoints {
+				t.Errorf("sent %d points, want %d", len(points), tt.wantPoints)
+			}
+			if mode, _ := gradient["mode"].(string); mode != tt.wantMode {
+				t.Errorf("sent mode %q, want %q", mode, tt.wantMode)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"os"
 
 	"go.viam.com/rdk/components/switch"
 	"go.viam.com/rdk/logging"
@@ -29,6 +31,7 @@ func realMain() error {
 	device := flag.String("device", "", "What device to control")
 	setting := flag.Int("set", -1, "What to set the device to")
 	register := flag.Bool("register", false, "Register with the Hue bridge to get a username (press link button first!)")
+	identify := flag.Bool("identify", false, "Flash each light in turn, printing its discovered name")
 
 	flag.Parse()
 
@@ -68,6 +71,11 @@ func realMain() error {
 	// Create a simple discovery helper directly
 	d := hue.NewDiscovery(logger)
 	d.SetBridge(*bridgeHost, *username)
+
+	if *identify {
+		return identifyAll(ctx, d)
+	}
+
 	all, err := d.DiscoverHue(ctx)
 	if err != nil {
 		return err
@@ -132,3 +140,30 @@ func realMain() error {
 
 	return nil
 }
+
+// identifyAll flashes each light one at a time so it can be matched to its
+// discovered component name, moving on when Enter is pressed. It stops when
+// stdin is closed, since there is no one left to press Enter.
+func identifyAll(ctx context.Context, d *hue.HueDiscover) error {
+	lights, err := d.DiscoveredLights(ctx)
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for i, l := range lights {
+		if err := d.Identify(ctx, l.ID, "lselect"); err != nil {
+			return err
+		}
+		fmt.Printf("[%d/%d] light %d %q -> component %q (press Enter for next)", i+1, len(lights), l.ID, l.Name, l.ComponentName)
+		_, readErr := in.ReadString('\n')
+		if err := d.Identify(ctx, l.ID, "none"); err != nil {
+			return err
+		}
+		if readErr != nil {
+			fmt.Println()
+			return fmt.Errorf("stopped identifying lights: %w", readErr)
+		}
+	}
+	return nil
+}
@@ -12,10 +12,11 @@ import (
 
 func main() {
 	module.ModularMain(
-		resource.APIModel{toggleswitch.API, hue.HueLightBrightness},
-		resource.APIModel{toggleswitch.API, hue.HueLightColor},
-		resource.APIModel{toggleswitch.API, hue.HueLightMode},
-		resource.APIModel{discovery.API, hue.HueDiscovery},
-		resource.APIModel{sensor.API, hue.HueLightSensor},
+		resource.APIModel{API: toggleswitch.API, Model: hue.HueLightBrightness},
+		resource.APIModel{API: toggleswitch.API, Model: hue.HueLightColor},
+		resource.APIModel{API: toggleswitch.API, Model: hue.HueLightMode},
+		resource.APIModel{API: discovery.API, Model: hue.HueDiscovery},
+		resource.APIModel{API: sensor.API, Model: hue.HueLightSensor},
+		resource.APIModel{API: sensor.API, Model: hue.HueGradient},
 	)
 }
@@ -0,0 +1,172 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// defaultMaxUpdatesPerS is how often a single light is written by default when
+// SetPosition calls arrive faster, e.g. while a slider is dragged. It leaves
+// room under the bridge's overall rate for other lights.
+const defaultMaxUpdatesPerS = 5
+
+// coalesceTimeout bounds a write after its caller may have stopped waiting.
+const coalesceTimeout = 10 * time.Second
+
+// lightChange computes the fields to send to a light from its current state,
+// which includes every change queued before it.
+type lightChange func(current huego.State) huego.State
+
+// writeBatch is a set of changes sent to a light as one command.
+type writeBatch struct {
+	changes  []lightChange
+	fade     int
+	interval time.Duration
+	current  bool        // some change needs the light's state from the bridge
+	claims   []*claimant // owners of the changes, each checked before sending
+
+	done chan struct{}
+	sent huego.State
+	err  error
+}
+
+// lightWriter serializes the writes to one light. While a write is in flight,
+// new changes are queued and then sent together as a single command, so a
+// burst of calls costs one bridge request per interval instead of one each.
+type lightWriter struct {
+	bridge *huego.Bridge
+	id     int
+
+	mu       sync.Mutex
+	pending  *writeBatch
+	sending  bool
+	lastSent time.Time
+}
+
+var (
+	lightWritersMu sync.Mutex
+	lightWriters   = map[string]*lightWriter{} // bridge/light ID -> writer
+)
+
+// writerFor returns the writer shared by every component on a light.
+func writerFor(bridge *huego.Bridge, id int) *lightWriter {
+	key := commandedKey(bridge, id)
+	lightWritersMu.Lock()
+	defer lightWritersMu.Unlock()
+	w, ok := lightWriters[key]
+	if !ok {
+		w = &lightWriter{bridge: bridge, id: id}
+		lightWriters[key] = w
+	}
+	return w
+}
+
+// update queues a change and waits until it has been sent, possibly together
+// with changes queued after it. It returns the state that was sent. Set
+// current when change reads the light's state; otherwise it is given only
+// the changes queued before it. maxPerS of 0 uses defaultMaxUpdatesPerS.
+// The claimant on ctx, if any, is checked again when the batch is sent.
+func (w *lightWriter) update(ctx context.Context, change lightChange, current bool, fade int, maxPerS float64) (huego.State, error) {
+	if maxPerS <= 0 {
+		maxPerS = defaultMaxUpdatesPerS
+	}
+
+	w.mu.Lock()
+	b := w.pending
+	if b == nil {
+		b = &writeBatch{done: make(chan struct{})}
+		w.pending = b
+	}
+	b.changes = append(b.changes, change)
+	b.current = b.current || current
+	if c := claimantFrom(ctx); c != nil {
+		b.claims = append(b.claims, c)
+	}
+	b.fade = fade // the newest call decides the fade
+	b.interval = time.Duration(float64(time.Second) / maxPerS)
+	if !w.sending {
+		w.sending = true
+		go w.run()
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.sent, b.err
+	case <-ctx.Done():
+		return huego.State{}, ctx.Err()
+	}
+}
+
+// run sends queued batches until none are left, at most one per interval.
+func (w *lightWriter) run() {
+	for {
+		w.mu.Lock()
+		b := w.pending
+		if b == nil {
+			w.sending = false
+			w.mu.Unlock()
+			return
+		}
+		wait := time.Until(w.lastSent.Add(b.interval))
+		w.mu.Unlock()
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		w.mu.Lock()
+		b = w.pending // changes may have joined while waiting
+		w.pending = nil
+		w.lastSent = time.Now()
+		w.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), coalesceTimeout)
+		b.sent, b.err = w.send(ctx, b)
+		cancel()
+		close(b.done)
+	}
+}
+
+// send applies a batch's changes in order and sends the result, unless an
+// owner of any of them has lost the light since queuing it.
+func (w *lightWriter) send(ctx context.Context, b *writeBatch) (huego.State, error) {
+	for _, c := range b.claims {
+		if err := c.check(w.bridge, w.id); err != nil {
+			return huego.State{}, err
+		}
+	}
+	if n := len(b.claims); n > 0 {
+		ctx = withClaimant(ctx, b.claims[n-1])
+	}
+
+	var cur huego.State
+	if b.current {
+		light, err := w.bridge.GetLightContext(ctx, w.id)
+		if err != nil {
+			return huego.State{}, fmt.Errorf("failed to get light state: %w", err)
+		}
+		if light.State != nil {
+			cur = *effectiveState(w.bridge, w.id, light.State)
+		}
+	}
+
+	var out huego.State
+	for _, change := range b.changes {
+		st := change(cur)
+		cur = mergeState(cur, st)
+		out = mergeState(out, st)
+	}
+	out.ColorMode = "" // read-only on the bridge
+	if !out.On {
+		out = huego.State{On: false} // an off light rejects other fields
+	}
+	if err := setLightState(ctx, w.bridge, w.id, out, b.fade); err != nil {
+		return huego.State{}, err
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package hue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+func TestLightWriterBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []huego.State
+		maxPuts int
+		want    map[string]interface{}
+	}{
+		{"single", []huego.State{{On: true, Bri: 100}}, 1, map[string]interface{}{"on": true, "bri": 100.0}},
+		{"burst", []huego.State{{On: true, Bri: 10}, {On: true, Bri: 20}, {On: true, Bri: 30}, {On: true, Bri: 40}, {On: true, Bri: 50}}, 2,
+			map[string]interface{}{"on": true, "bri": 50.0}},
+		{"color then brightness", []huego.State{{On: true, Xy: []float32{0.5, 0.4}}, {On: true, Bri: 80}}, 2,
+			map[string]interface{}{"on": true, "bri": 80.0}},
+		{"off drops other fields", []huego.State{{On: true, Bri: 80}, {On: false}}, 2, map[string]interface{}{"on": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, nil)
+			w := &lightWriter{bridge: f.Bridge, id: 1}
+
+			var wg sync.WaitGroup
+			for _, st := range tt.changes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := w.update(context.Background(), func(huego.State) huego.State { return st }, false, 0, 10); err != nil {
+						t.Error(err)
+					}
+				}()
+				time.Sleep(time.Millisecond) // keep the order
+			}
+			wg.Wait()
+
+			if n := len(f.writes("/lights/1/state")); n == 0 || n > tt.maxPuts {
+				t.Errorf("%d writes for %d changes, want 1-%d", n, len(tt.changes), tt.maxPuts)
+			}
+			got := f.state(1)
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("light %s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLightWriterChecksClaims(t *testing.T) {
+	f := newFakeBridge(t)
+	f.addLight(1, nil)
+	logger := logging.NewTestLogger(t)
+	manual := newClaimant("brightness", nil, priorityManual, defaultManualHold, logger)
+	mode := newClaimant("mode", nil, priorityMode, 0, logger)
+	defer manual.close(f.Bridge)
+	defer mode.close(f.Bridge)
+
+	if err := manual.claim(f.Bridge, []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	// the mode takes the light after the manual write was allowed, before it is sent
+	if err := mode.claim(f.Bridge, []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	w := &lightWriter{bridge: f.Bridge, id: 1}
+	ctx := withClaimant(context.Background(), manual)
+	if _, err := w.update(ctx, func(huego.State) huego.State { return huego.State{On: true, Bri: 1} }, false, 0, 100); err == nil {
+		t.Error("a write from an owner that lost the light was sent")
+	}
+	if n := len(f.writes("/lights/1/state")); n != 0 {
+		t.Errorf("%d writes reached the bridge, want none", n)
+	}
+}
@@ -0,0 +1,107 @@
+package hue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// commandedState is the state the module last sent to a light. Reads return
+// it instead of the bridge's value while the light is still fading, and
+// afterwards for as long as the bridge agrees with it, so a value read right
+// after a write is the value written rather than a rounded or stale one.
+type commandedState struct {
+	state huego.State
+	until time.Time // when the transition completes
+}
+
+var (
+	commandedMu sync.Mutex
+	commanded   = map[string]*commandedState{} // bridge/light ID -> last command
+)
+
+func commandedKey(bridge *huego.Bridge, id int) string {
+	return fmt.Sprintf("%s/%d", bridgeKey(bridge), id)
+}
+
+// recordCommand merges a state just sent to a light into its commanded state.
+// Fields the command leaves unset keep their earlier commanded values.
+func recordCommand(bridge *huego.Bridge, id int, state huego.State, transitionMs int) {
+	if transitionMs < 0 {
+		transitionMs = 400 // bridge default
+	}
+	commandedMu.Lock()
+	defer commandedMu.Unlock()
+	key := commandedKey(bridge, id)
+	c, ok := commanded[key]
+	if !ok {
+		c = &commandedState{}
+		commanded[key] = c
+	}
+	c.state = mergeState(c.state, state)
+	c.until = time.Now().Add(time.Duration(transitionMs) * time.Millisecond)
+}
+
+// forgetCommand drops a light's commanded state, e.g. after a relative change
+// whose result only the bridge knows.
+func forgetCommand(bridge *huego.Bridge, id int) {
+	commandedMu.Lock()
+	defer commandedMu.Unlock()
+	delete(commanded, commandedKey(bridge, id))
+}
+
+// mergeState applies the fields a command sets on top of an earlier state.
+// A new color replaces the earlier one whatever its color mode.
+func mergeState(base, change huego.State) huego.State {
+	base.On = change.On
+	if change.Bri != 0 {
+		base.Bri = change.Bri
+	}
+	switch {
+	case len(change.Xy) == 2:
+		base.Xy, base.Ct, base.Hue, base.Sat = change.Xy, 0, 0, 0
+		base.ColorMode = "xy"
+	case change.Ct != 0:
+		base.Xy, base.Ct, base.Hue, base.Sat = nil, change.Ct, 0, 0
+		base.ColorMode = "ct"
+	case change.Hue != 0 || change.Sat != 0:
+		base.Xy, base.Ct, base.Hue, base.Sat = nil, 0, change.Hue, change.Sat
+		base.ColorMode = "hs"
+	}
+	if change.Effect != "" {
+		base.Effect = change.Effect
+	}
+	return base
+}
+
+// effectiveState returns what reads should report for a light given the
+// state just read from the bridge: the commanded state while the light is
+// fading toward it or once the bridge confirms it, otherwise the bridge's
+// state. A light changed from elsewhere forgets its commanded state.
+func effectiveState(bridge *huego.Bridge, id int, got *huego.State) *huego.State {
+	commandedMu.Lock()
+	defer commandedMu.Unlock()
+	key := commandedKey(bridge, id)
+	c, ok := commanded[key]
+	if !ok || got == nil {
+		return got
+	}
+	if time.Now().Before(c.until) || !stateDrifted(c.state, got) {
+		st := *got
+		st.On = c.state.On
+		if c.state.Bri != 0 {
+			st.Bri = c.state.Bri
+		}
+		switch c.state.ColorMode {
+		case "xy", "ct":
+			st.ColorMode, st.Xy, st.Ct = c.state.ColorMode, c.state.Xy, c.state.Ct
+		case "hs":
+			st.ColorMode, st.Hue, st.Sat = c.state.ColorMode, c.state.Hue, c.state.Sat
+		}
+		return &st
+	}
+	delete(commanded, key)
+	return got
+}
@@ -0,0 +1,80 @@
+package hue
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func TestMergeState(t *testing.T) {
+	xy := huego.State{On: true, Bri: 100, Xy: []float32{0.3, 0.4}, ColorMode: "xy"}
+	tests := []struct {
+		name   string
+		base   huego.State
+		change huego.State
+		want   huego.State
+	}{
+		{"bri keeps color", xy, huego.State{On: true, Bri: 200},
+			huego.State{On: true, Bri: 200, Xy: []float32{0.3, 0.4}, ColorMode: "xy"}},
+		{"off keeps bri", xy, huego.State{On: false},
+			huego.State{On: false, Bri: 100, Xy: []float32{0.3, 0.4}, ColorMode: "xy"}},
+		{"ct replaces xy", xy, huego.State{On: true, Ct: 300},
+			huego.State{On: true, Bri: 100, Ct: 300, ColorMode: "ct"}},
+		{"hs replaces xy", xy, huego.State{On: true, Hue: 1000, Sat: 254},
+			huego.State{On: true, Bri: 100, Hue: 1000, Sat: 254, ColorMode: "hs"}},
+		{"xy replaces ct", huego.State{On: true, Bri: 50, Ct: 300, ColorMode: "ct"}, huego.State{On: true, Xy: []float32{0.5, 0.5}},
+			huego.State{On: true, Bri: 50, Xy: []float32{0.5, 0.5}, ColorMode: "xy"}},
+		{"effect", xy, huego.State{On: true, Effect: "colorloop"},
+			huego.State{On: true, Bri: 100, Xy: []float32{0.3, 0.4}, ColorMode: "xy", Effect: "colorloop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeState(tt.base, tt.change); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeState = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveState(t *testing.T) {
+	sent := huego.State{On: true, Bri: 200, Ct: 300}
+	tests := []struct {
+		name       string
+		fadeMs     int // fade of the recorded command; -1 records nothing
+		got        huego.State
+		wantBri    uint8
+		wantForget bool
+	}{
+		{"nothing commanded", -1, huego.State{On: true, Bri: 90, ColorMode: "ct", Ct: 300}, 90, false},
+		{"still fading", 10000, huego.State{On: true, Bri: 90, ColorMode: "ct", Ct: 250}, 200, false},
+		{"bridge rounded", 0, huego.State{On: true, Bri: 199, ColorMode: "ct", Ct: 301}, 200, false},
+		{"changed elsewhere", 0, huego.State{On: true, Bri: 50, ColorMode: "ct", Ct: 300}, 50, true},
+		{"turned off elsewhere", 0, huego.State{On: false, Bri: 200, ColorMode: "ct", Ct: 300}, 200, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := testBridge(t)
+			if tt.fadeMs >= 0 {
+				recordCommand(bridge, 1, sent, tt.fadeMs)
+			}
+			got := tt.got
+			st := effectiveState(bridge, 1, &got)
+			if st.Bri != tt.wantBri {
+				t.Errorf("bri = %d, want %d", st.Bri, tt.wantBri)
+			}
+			if tt.fadeMs >= 0 && !tt.wantForget && (st.ColorMode != "ct" || st.Ct != 300) {
+				t.Errorf("color = %s %d, want the commanded ct 300", st.ColorMode, st.Ct)
+			}
+			commandedMu.Lock()
+			_, kept := commanded[commandedKey(bridge, 1)]
+			commandedMu.Unlock()
+			if tt.fadeMs >= 0 && kept == tt.wantForget {
+				t.Errorf("commanded state kept = %v, want %v", kept, !tt.wantForget)
+			}
+		})
+	}
+	if effectiveState(testBridge(t), 1, nil) != nil {
+		t.Error("effectiveState of an unread light is not nil")
+	}
+}
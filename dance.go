@@ -0,0 +1,212 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// DanceStyle customizes a dance mode. Setting a palette or period makes the
+// module drive the colors itself instead of using the bridge's fixed-speed
+// colorloop, so any set of colors works on any color light.
+type DanceStyle struct {
+	Palette      []interface{}      `json:"palette,omitempty"`       // colors in any form parseColor accepts
+	PeriodMs     int                `json:"period_ms,omitempty"`     // one trip through the palette, default 10000
+	Phase        string             `json:"phase,omitempty"`         // "spread" (default), "sync" or "step"
+	PhaseOffsets map[string]float64 `json:"phase_offsets,omitempty"` // dance group -> fraction of a cycle, overriding phase
+	Brightness   float64            `json:"brightness,omitempty"`    // percent; unset leaves brightness alone
+}
+
+const (
+	defaultDancePeriodMs = 10000
+	danceStepsPerColor   = 4 // frames between palette colors, each fading into the next
+)
+
+// danceWheel is used when a period is set without a palette.
+var danceWheel = []interface{}{"#ff0000", "#ffff00", "#00ff00", "#00ffff", "#0000ff", "#ff00ff"}
+
+// driven reports whether the module animates the dance rather than the bridge.
+func (ds *DanceStyle) driven() bool {
+	return ds != nil && (len(ds.Palette) > 0 || ds.PeriodMs > 0)
+}
+
+func (ds *DanceStyle) validate(groups map[string][]int) error {
+	if len(ds.Palette) == 1 {
+		return fmt.Errorf("dance palette needs at least two colors")
+	}
+	for i, c := range ds.Palette {
+		if _, _, err := parseColor(c); err != nil {
+			return fmt.Errorf("dance palette color %d: %w", i, err)
+		}
+	}
+	if ds.PeriodMs < 0 {
+		return fmt.Errorf("dance period_ms must be positive, got %d", ds.PeriodMs)
+	}
+	switch ds.Phase {
+	case "", "spread", "sync", "step":
+	default:
+		return fmt.Errorf("dance phase must be \"spread\", \"sync\" or \"step\", got %q", ds.Phase)
+	}
+	for name, off := range ds.PhaseOffsets {
+		if _, ok := groups[name]; !ok {
+			return fmt.Errorf("dance phase_offsets names unknown group %q", name)
+		}
+		if off < 0 || off >= 1 {
+			return fmt.Errorf("dance phase offset for %q must be in [0, 1), got %v", name, off)
+		}
+	}
+	if ds.Brightness < 0 || ds.Brightness > 100 {
+		return fmt.Errorf("dance brightness must be 1-100, got %v", ds.Brightness)
+	}
+	return nil
+}
+
+// dance is a module-driven dance bound to its groups of lights. Every light in
+// a group shows the same color; groups are offset from each other in the cycle.
+type dance struct {
+	groups  map[string][]int
+	keys    []string // sorted group names
+	lights  []int
+	palette [][]float32
+	period  time.Duration
+	bri     uint8
+	offsets map[string]float64 // group -> fraction of a cycle
+	caps    map[int]lightCaps  // lights without color pulse brightness instead
+}
+
+func newDance(style *DanceStyle, groups map[string][]int, caps map[int]lightCaps) (*dance, error) {
+	if err := style.validate(groups); err != nil {
+		return nil, err
+	}
+	d := &dance{
+		groups:  groups,
+		keys:    sortedKeys(groups),
+		lights:  flattenDanceGroups(groups),
+		period:  time.Duration(style.PeriodMs) * time.Millisecond,
+		offsets: map[string]float64{},
+		caps:    caps,
+	}
+	if len(d.lights) == 0 {
+		return nil, fmt.Errorf("dance needs at least one light")
+	}
+	if d.period == 0 {
+		d.period = defaultDancePeriodMs * time.Millisecond
+	}
+	if style.Brightness > 0 {
+		d.bri = percentToBri(style.Brightness)
+	}
+
+	palette := style.Palette
+	if len(palette) == 0 {
+		palette = danceWheel
+	}
+	for _, c := range palette {
+		x, y, err := parseColor(c)
+		if err != nil {
+			return nil, err
+		}
+		d.palette = append(d.palette, []float32{x, y})
+	}
+
+	n := len(d.keys)
+	for i, k := range d.keys {
+		switch style.Phase {
+		case "sync":
+			d.offsets[k] = 0
+		case "step":
+			d.offsets[k] = math.Mod(float64(i)/float64(len(d.palette)), 1)
+		default:
+			d.offsets[k] = float64(i) / float64(n)
+		}
+		if off, ok := style.PhaseOffsets[k]; ok {
+			d.offsets[k] = off
+		}
+	}
+	return d, nil
+}
+
+// tick is the time between frames, stretched when there are too many lights
+// to update each frame within the bridge's command rate.
+func (d *dance) tick() time.Duration {
+	t := d.period / time.Duration(len(d.palette)*danceStepsPerColor)
+	return max(t, time.Duration(len(d.lights))*time.Second/bridgeCommandsPerSecond)
+}
+
+// colorAt returns the palette color at a fraction of the cycle, blending
+// between neighboring colors.
+func (d *dance) colorAt(p float64) []float32 {
+	pos := math.Mod(p, 1) * float64(len(d.palette))
+	i := int(pos) % len(d.palette)
+	f := pos - math.Floor(pos)
+	a, b := d.palette[i], d.palette[(i+1)%len(d.palette)]
+	return []float32{
+		float32(lerp(float64(a[0]), float64(b[0]), f)),
+		float32(lerp(float64(a[1]), float64(b[1]), f)),
+	}
+}
+
+// pulseBri is the brightness of a light without color at a fraction of the
+// cycle, swinging between dim and full once per palette color.
+func (d *dance) pulseBri(p float64) uint8 {
+	return percentToBri(lerp(10, 100, 0.5+0.5*math.Cos(2*math.Pi*p*float64(len(d.palette)))))
+}
+
+func (d *dance) category() string       { return "dance" }
+func (d *dance) name() string           { return "dance" }
+func (d *dance) lightIDs() []int        { return d.lights }
+func (d *dance) timeout() time.Duration { return 0 }
+
+func (d *dance) status() map[string]interface{} {
+	return map[string]interface{}{"period_ms": int(d.period / time.Millisecond)}
+}
+
+// run fades every group toward where it will be in the cycle one frame later,
+// updating the lights of a frame in parallel so groups stay in step.
+func (d *dance) run(ctx context.Context, bridge *huego.Bridge, logger logging.Logger) {
+	tick := d.tick()
+	steps := len(d.palette) * danceStepsPerColor
+	group := map[int]string{}
+	for _, k := range d.keys {
+		for _, id := range d.groups[k] {
+			group[id] = k
+		}
+	}
+
+	for step := 0; ; step++ {
+		transitionMs := int(tick / time.Millisecond)
+		if step == 0 {
+			transitionMs = 0
+		}
+		errs := forEachLight(ctx, d.lights, func(ctx context.Context, id int) error {
+			p := float64(step)/float64(steps) + d.offsets[group[id]]
+			state := huego.State{On: true, Bri: d.bri, Xy: d.colorAt(p)}
+			if c, ok := d.caps[id]; ok && !c.color {
+				if !c.dim {
+					if step > 0 {
+						return nil
+					}
+					return setLightState(ctx, bridge, id, huego.State{On: true}, transitionDefault)
+				}
+				state = huego.State{On: true, Bri: d.pulseBri(p)}
+			}
+			if step == 0 {
+				state.Effect = "none" // a leftover colorloop would override the colors
+			}
+			return setLightState(ctx, bridge, id, state, transitionMs)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errs != nil {
+			// one unreachable bulb should not stop the rest of the dance
+			logger.Debugf("dance: %v", errs)
+		}
+		if sleepCtx(ctx, tick) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package hue
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDanceStyleValidate(t *testing.T) {
+	groups := map[string][]int{"a": {1}, "b": {2}}
+	tests := []struct {
+		name    string
+		style   DanceStyle
+		wantErr string
+	}{
+		{"empty", DanceStyle{}, ""},
+		{"palette", DanceStyle{Palette: []interface{}{"#ff0000", []interface{}{0.0, 0.0, 255.0}}, PeriodMs: 4000, Phase: "step"}, ""},
+		{"offsets", DanceStyle{PhaseOffsets: map[string]float64{"a": 0.5}}, ""},
+		{"one color", DanceStyle{Palette: []interface{}{"#ff0000"}}, "at least two colors"},
+		{"bad color", DanceStyle{Palette: []interface{}{"#ff0000", "mauve-ish"}}, "palette color 1"},
+		{"negative period", DanceStyle{PeriodMs: -1}, "period_ms"},
+		{"bad phase", DanceStyle{Phase: "wave"}, "dance phase must be"},
+		{"unknown group", DanceStyle{PhaseOffsets: map[string]float64{"c": 0.5}}, "unknown group \"c\""},
+		{"offset out of range", DanceStyle{PhaseOffsets: map[string]float64{"a": 1}}, "must be in [0, 1)"},
+		{"brightness", DanceStyle{Brightness: 120}, "brightness must be 1-100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.style.validate(groups)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDanceStyleDriven(t *testing.T) {
+	var unset *DanceStyle
+	if unset.driven() || (&DanceStyle{Phase: "sync"}).driven() {
+		t.Error("a dance without palette or period should use the bridge colorloop")
+	}
+	if !(&DanceStyle{PeriodMs: 5000}).driven() || !(&DanceStyle{Palette: []interface{}{"#ff0000", "#00ff00"}}).driven() {
+		t.Error("a palette or period should make the module drive the dance")
+	}
+}
+
+func TestDanceOffsets(t *testing.T) {
+	groups := map[string][]int{"a": {1}, "b": {2}, "c": {3}, "d": {4}}
+	palette := []interface{}{"#ff0000", "#00ff00"}
+	tests := []struct {
+		name  string
+		style DanceStyle
+		want  map[string]float64
+	}{
+		{"spread", DanceStyle{Palette: palette}, map[string]float64{"a": 0, "b": 0.25, "c": 0.5, "d": 0.75}},
+		{"sync", DanceStyle{Palette: palette, Phase: "sync"}, map[string]float64{"a": 0, "b": 0, "c": 0, "d": 0}},
+		{"step", DanceStyle{Palette: palette, Phase: "step"}, map[string]float64{"a": 0, "b": 0.5, "c": 0, "d": 0.5}},
+		{"explicit offset", DanceStyle{Palette: palette, Phase: "sync", PhaseOffsets: map[string]float64{"c": 0.3}},
+			map[string]float64{"a": 0, "b": 0, "c": 0.3, "d": 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDance(&tt.style, groups, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(d.offsets, tt.want) {
+				t.Errorf("offsets = %v, want %v", d.offsets, tt.want)
+			}
+		})
+	}
+}
+
+func TestDanceColorAt(t *testing.T) {
+	d := &dance{palette: [][]float32{{0.6, 0.3}, {0.2, 0.1}}}
+	tests := []struct {
+		p    float64
+		want []float32
+	}{
+		{0, []float32{0.6, 0.3}},
+		{0.25, []float32{0.4, 0.2}},
+		{0.5, []float32{0.2, 0.1}},
+		{0.75, []float32{0.4, 0.2}}, // blends back to the first color
+		{1.25, []float32{0.4, 0.2}}, // wraps around
+	}
+	for _, tt := range tests {
+		got := d.colorAt(tt.p)
+		if math.Abs(float64(got[0]-tt.want[0])) > 1e-6 || math.Abs(float64(got[1]-tt.want[1])) > 1e-6 {
+			t.Errorf("colorAt(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestDanceTick(t *testing.T) {
+	tests := []struct {
+		name   string
+		period time.Duration
+		lights int
+		want   time.Duration
+	}{
+		{"palette pace", 8 * time.Second, 2, time.Second},               // 8s / (2 colors * 4 steps)
+		{"stretched for many lights", time.Second, 20, 2 * time.Second}, // 20 lights at 10 commands/s
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dance{period: tt.period, palette: make([][]float32, 2), lights: make([]int, tt.lights)}
+			if got := d.tick(); got != tt.want {
+				t.Errorf("tick = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/amimof/huego"
@@ -120,7 +121,39 @@ func (s *HueDiscover) Name() resource.Name {
 	return s.name
 }
 
+// discoveryCommands maps DoCommand keys to their handlers. Each handler gets
+// the value stored under its key.
+var discoveryCommands = map[string]func(*HueDiscover, context.Context, interface{}) (map[string]interface{}, error){
+	"list_schedules":   (*HueDiscover).listSchedules,
+	"create_schedule":  (*HueDiscover).createSchedule,
+	"update_schedule":  (*HueDiscover).updateSchedule,
+	"enable_schedule":  (*HueDiscover).enableSchedule,
+	"disable_schedule": (*HueDiscover).disableSchedule,
+	"delete_schedule":  (*HueDiscover).deleteSchedule,
+	"list_rules":       (*HueDiscover).listRules,
+	"create_rule":      (*HueDiscover).createRule,
+	"update_rule":      (*HueDiscover).updateRule,
+	"delete_rule":      (*HueDiscover).deleteRule,
+	"list_sensors":     (*HueDiscover).listSensors,
+	"create_sensor":    (*HueDiscover).createSensor,
+	"update_sensor":    (*HueDiscover).updateSensor,
+	"delete_sensor":    (*HueDiscover).deleteSensor,
+}
+
 func (s *HueDiscover) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	var found []string
+	for name := range cmd {
+		if _, ok := discoveryCommands[name]; ok {
+			found = append(found, name)
+		}
+	}
+	if len(found) > 1 {
+		sort.Strings(found)
+		return nil, fmt.Errorf("send one command at a time, got %s", strings.Join(found, ", "))
+	}
+	if len(found) == 1 {
+		return discoveryCommands[found[0]](s, ctx, cmd[found[0]])
+	}
 	return nil, nil
 }
 
@@ -128,6 +161,33 @@ func (s *HueDiscover) DiscoverResources(ctx context.Context, extra map[string]an
 	return s.DiscoverHue(ctx)
 }
 
+// DiscoveredLight pairs a bridge light with the component name discovery gives it.
+type DiscoveredLight struct {
+	ID            int
+	Name          string
+	ComponentName string
+}
+
+// DiscoveredLights lists every light on the bridge, sorted by ID.
+func (s *HueDiscover) DiscoveredLights(ctx context.Context) ([]DiscoveredLight, error) {
+	lights, err := s.bridge.GetLightsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get lights from Hue bridge: %w", err)
+	}
+	out := make([]DiscoveredLight, len(lights))
+	for i, l := range lights {
+		out[i] = DiscoveredLight{ID: l.ID, Name: l.Name, ComponentName: sanitizeName(l.Name)}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// Identify sets the bridge alert on a light: "select", "lselect", or "none".
+func (s *HueDiscover) Identify(ctx context.Context, lightID int, alert string) error {
+	_, err := setAlert(ctx, s.bridge, lightID, alert)
+	return err
+}
+
 // sanitizeName replaces any character that is not alphanumeric, '-', or '_'
 // with '-', then collapses runs of '-' and trims leading/trailing '-'.
 var reUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
@@ -145,6 +205,8 @@ func (s *HueDiscover) DiscoverHue(ctx context.Context) ([]resource.Config, error
 		return nil, fmt.Errorf("cannot get lights from Hue bridge: %w", err)
 	}
 
+	gradientLightIDs := s.gradientLightIDs(ctx)
+
 	configs := []resource.Config{}
 	var colorLightIDs []int
 
@@ -179,6 +241,15 @@ func (s *HueDiscover) DiscoverHue(ctx context.Context) ([]resource.Config, error
 			Attributes: baseAttrs,
 		})
 
+		if gradientLightIDs[light.ID] {
+			configs = append(configs, resource.Config{
+				Name:       fmt.Sprintf("%s-gradient", safeName),
+				API:        sensor.API,
+				Model:      HueGradient,
+				Attributes: baseAttrs,
+			})
+		}
+
 		// Color lights get one switch per RGB channel.
 		if supportsColor {
 			colorLightIDs = append(colorLightIDs, light.ID)
@@ -215,3 +286,24 @@ func (s *HueDiscover) DiscoverHue(ctx context.Context) ([]resource.Config, error
 
 	return configs, nil
 }
+
+// gradientLightIDs returns the v1 IDs of lights that report gradient support
+// over the v2 API. Older bridges without v2 simply yield no gradient lights.
+func (s *HueDiscover) gradientLightIDs(ctx context.Context) map[int]bool {
+	ids := map[int]bool{}
+	lights, err := newClipV2Client(s.bridge.Host, s.cfg.Username).getLights(ctx)
+	if err != nil {
+		s.logger.Debugf("cannot list v2 lights, skipping gradient discovery: %v", err)
+		return ids
+	}
+	for _, l := range lights {
+		if l.Gradient == nil {
+			continue
+		}
+		var id int
+		if _, err := fmt.Sscanf(l.IDV1, "/lights/%d", &id); err == nil {
+			ids[id] = true
+		}
+	}
+	return ids
+}
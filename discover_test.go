@@ -0,0 +1,41 @@
+package hue
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverDoCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     map[string]interface{}
+		wantErr string
+		wantNil bool
+	}{
+		{"empty", map[string]interface{}{}, "", true},
+		{"unknown", map[string]interface{}{"reboot": true}, "", true},
+		{"two commands", map[string]interface{}{"list_schedules": true, "list_rules": true}, "send one command at a time, got list_rules, list_schedules", false},
+		{"one command", map[string]interface{}{"list_schedules": true, "extra": 1}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.routes["GET /schedules"] = map[string]interface{}{}
+			s := &HueDiscover{cfg: &DiscoveryConfig{Username: "user"}, bridge: f.Bridge}
+			got, err := s.DoCommand(context.Background(), tt.cmd)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("DoCommand = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// What hue-lights-mode does when a mode's lights no longer match it.
+const (
+	driftOff     = "off"     // never check
+	driftFlag    = "flag"    // keep the position and report drifted in mode_status (default)
+	driftNone    = "none"    // report position "none" and drop the baseline
+	driftReapply = "reapply" // put the drifted lights back into the mode
+)
+
+const (
+	// driftCacheTTL limits how often GetPosition reads the bridge.
+	driftCacheTTL = 2 * time.Second
+	// driftSettle is added to a mode's fade before its lights are checked,
+	// so lights still fading in are not reported as drifted.
+	driftSettle = time.Second
+
+	driftBriTolerance = 3
+	driftCtTolerance  = 5
+	driftXyTolerance  = 0.03 // lights clamp xy to their gamut
+)
+
+func validateDriftCheck(action string) error {
+	switch action {
+	case "", driftOff, driftFlag, driftNone, driftReapply:
+		return nil
+	}
+	return fmt.Errorf("drift_check must be \"off\", \"flag\", \"none\" or \"reapply\", got %q", action)
+}
+
+// stateDrifted reports whether a light's state no longer matches the state a
+// mode put it in. Fields the mode leaves unset are not compared.
+func stateDrifted(want huego.State, got *huego.State) bool {
+	if got.On != want.On {
+		return true
+	}
+	if !want.On {
+		return false
+	}
+	if want.Bri != 0 && math.Abs(float64(got.Bri)-float64(want.Bri)) > driftBriTolerance {
+		return true
+	}
+	if want.Ct != 0 {
+		// a ct warmer than the light supports reads back as its warmest
+		wantCt := float64(want.Ct)
+		if want.Ct > maxCommonCt && got.Ct >= maxCommonCt {
+			wantCt = float64(got.Ct)
+		}
+		if got.ColorMode != "ct" || math.Abs(float64(got.Ct)-wantCt) > driftCtTolerance {
+			return true
+		}
+	}
+	if len(want.Xy) == 2 {
+		if got.ColorMode != "xy" || len(got.Xy) != 2 ||
+			math.Abs(float64(got.Xy[0]-want.Xy[0])) > driftXyTolerance ||
+			math.Abs(float64(got.Xy[1]-want.Xy[1])) > driftXyTolerance {
+			return true
+		}
+	}
+	return want.Effect == "colorloop" && got.Effect != "colorloop"
+}
+
+// driftedLights returns the active mode's lights that no longer match it,
+// reading the bridge at most once per driftCacheTTL. Only state modes and
+// colorloop dances have a fixed target to compare against. s.mu must be held.
+func (s *hueLightMode) driftedLights(ctx context.Context) ([]int, error) {
+	if s.position == 0 || s.cfg.DriftCheck == driftOff || time.Now().Before(s.settleAt) {
+		return nil, nil
+	}
+	mode := s.modes[s.position-1]
+	if mode.kind != modeKindState && (mode.kind != modeKindDance || mode.danceStyle.driven()) {
+		return nil, nil
+	}
+	if time.Since(s.driftCheckedAt) < driftCacheTTL {
+		return s.drifted, nil
+	}
+
+	lights, err := s.bridge.GetLightsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lights: %w", err)
+	}
+	states := make(map[int]*huego.State, len(lights))
+	for i := range lights {
+		states[lights[i].ID] = lights[i].State
+	}
+
+	caps := s.capsFor(ctx, s.activeLights)
+	var drifted []int
+	for _, id := range s.activeLights {
+		got, ok := states[id]
+		if !ok || got == nil || !got.Reachable {
+			continue // an unreachable light reports stale state
+		}
+		switch mode.kind {
+		case modeKindDance:
+			// lights without color pulse or just stay on
+			if caps[id].color && (!got.On || got.Effect != "colorloop") {
+				drifted = append(drifted, id)
+			}
+		case modeKindState:
+			st := mode.stateFor(id)
+			if st == nil {
+				continue
+			}
+			want, _ := adaptState(st.hueState(), caps[id])
+			if stateDrifted(limitedState(s.bridge, id, want), got) {
+				drifted = append(drifted, id)
+			}
+		}
+	}
+	sort.Ints(drifted)
+	s.drifted, s.driftCheckedAt = drifted, time.Now()
+	return drifted, nil
+}
+
+// checkDrift compares the lights with the active mode and applies the
+// configured drift_check action. s.mu must be held.
+func (s *hueLightMode) checkDrift(ctx context.Context) error {
+	drifted, err := s.driftedLights(ctx)
+	if err != nil || len(drifted) == 0 {
+		return err
+	}
+
+	mode := s.modes[s.position-1]
+	switch s.cfg.DriftCheck {
+	case driftNone:
+		s.logger.Infof("lights %v were changed outside mode %q, switching to none", drifted, mode.name)
+		// the same teardown as switching to none, minus the restore
+		s.jobs.stop()
+		s.reconcile.clear()
+		unregisterLimits(s.bridge, s.modeLimitsOwner())
+		s.claim.keep(s.bridge, nil)
+		s.position = 0
+		s.savedStates = make(map[int]*huego.State)
+		s.activeLights = nil
+		s.degraded = nil
+		s.resetDrift()
+	case driftReapply:
+		if s.reapplyPending {
+			return nil
+		}
+		s.logger.Infof("lights %v were changed outside mode %q, re-applying them", drifted, mode.name)
+		// Reads only start the re-apply: it runs once the caller lets go of
+		// s.mu, and skips lights the switch has moved away from since.
+		s.reapplyPending = true
+		s.reapplying.Add(1)
+		position := s.position
+		go func() {
+			defer s.reapplying.Done()
+			ctx, cancel := context.WithTimeout(withClaimant(context.Background(), s.claim), restoreTimeout)
+			defer cancel()
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.reapplyPending = false
+			s.resetDrift()
+			if err := s.reapplyLights(ctx, position, drifted); err != nil {
+				s.logger.Warnf("failed to re-apply mode %q: %v", mode.name, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// resetDrift forgets the last drift check, e.g. after the lights were set.
+func (s *hueLightMode) resetDrift() {
+	s.drifted = nil
+	s.driftCheckedAt = time.Time{}
+}
+
+// pollDrift checks for drift in the background every interval until ctx is
+// done, so drift_check "none" and "reapply" act without anyone calling
+// GetPosition.
+func (s *hueLightMode) pollDrift(ctx context.Context, interval time.Duration) {
+	ctx = withClaimant(ctx, s.claim)
+	for sleepCtx(ctx, interval) == nil {
+		s.mu.Lock()
+		if err := s.checkDrift(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Debugf("drift check failed: %v", err)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,40 @@
+package hue
+
+import (
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func TestStateDrifted(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  huego.State
+		got   huego.State
+		drift bool
+	}{
+		{"off matches off", huego.State{On: false}, huego.State{On: false, Bri: 200}, false},
+		{"turned on", huego.State{On: false}, huego.State{On: true}, true},
+		{"turned off", huego.State{On: true, Bri: 100}, huego.State{On: false, Bri: 100}, true},
+		{"bri within tolerance", huego.State{On: true, Bri: 100}, huego.State{On: true, Bri: 103}, false},
+		{"bri changed", huego.State{On: true, Bri: 100}, huego.State{On: true, Bri: 110}, true},
+		{"bri unset", huego.State{On: true}, huego.State{On: true, Bri: 1}, false},
+		{"ct matches", huego.State{On: true, Ct: 300}, huego.State{On: true, Ct: 304, ColorMode: "ct"}, false},
+		{"ct changed", huego.State{On: true, Ct: 300}, huego.State{On: true, Ct: 350, ColorMode: "ct"}, true},
+		{"ct in other color mode", huego.State{On: true, Ct: 300}, huego.State{On: true, Ct: 300, ColorMode: "xy"}, true},
+		{"ct past warmest", huego.State{On: true, Ct: 500}, huego.State{On: true, Ct: 454, ColorMode: "ct"}, false},
+		{"xy clamped to gamut", huego.State{On: true, Xy: []float32{0.7, 0.3}}, huego.State{On: true, Xy: []float32{0.68, 0.31}, ColorMode: "xy"}, false},
+		{"xy changed", huego.State{On: true, Xy: []float32{0.7, 0.3}}, huego.State{On: true, Xy: []float32{0.3, 0.3}, ColorMode: "xy"}, true},
+		{"xy in hs mode", huego.State{On: true, Xy: []float32{0.7, 0.3}}, huego.State{On: true, Xy: []float32{0.7, 0.3}, ColorMode: "hs"}, true},
+		{"colorloop running", huego.State{On: true, Effect: "colorloop"}, huego.State{On: true, Effect: "colorloop"}, false},
+		{"colorloop stopped", huego.State{On: true, Effect: "colorloop"}, huego.State{On: true, Effect: "none"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.got
+			if d := stateDrifted(tt.want, &got); d != tt.drift {
+				t.Errorf("stateDrifted = %v, want %v", d, tt.drift)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// EffectConfig describes a software-driven animation. Unlike the bridge's
+// built-in colorloop, these run in the module and work on any color light.
+type EffectConfig struct {
+	Type          string        `json:"type"`
+	Lights        []int         `json:"lights,omitempty"`         // only used by start_effect; modes use their own lights
+	PeriodMs      int           `json:"period_ms,omitempty"`      // length of one cycle, smaller is faster
+	Palette       []interface{} `json:"palette,omitempty"`        // colors in any form parseColor accepts
+	MinBrightness float64       `json:"min_brightness,omitempty"` // percent, default 10
+	MaxBrightness float64       `json:"max_brightness,omitempty"` // percent, default 100
+	DurationS     float64       `json:"duration_s,omitempty"`     // 0 runs until stopped
+}
+
+// effectDefaults holds the period and palette used when the config leaves them out.
+var effectDefaults = map[string]struct {
+	periodMs int
+	palette  []interface{}
+}{
+	"breathe":   {periodMs: 4000},
+	"strobe":    {periodMs: 200},
+	"candle":    {periodMs: 300, palette: []interface{}{"#ff9329", "#ff8a1c"}},
+	"fire":      {periodMs: 200, palette: []interface{}{"#ff2200", "#ff5500", "#ff8800", "#ffaa00"}},
+	"police":    {periodMs: 1000, palette: []interface{}{"#ff0000", "#0000ff"}},
+	"lightning": {periodMs: 400, palette: []interface{}{"#c8d7ff"}},
+	"chase":     {periodMs: 1000},
+	"rainbow":   {periodMs: 10000},
+}
+
+const (
+	rainbowSteps         = 12   // frames per rainbow cycle
+	lightningFlashChance = 0.12 // per light, per frame
+)
+
+func (cfg *EffectConfig) validate() error {
+	if _, ok := effectDefaults[cfg.Type]; !ok {
+		return fmt.Errorf("unknown effect type %q", cfg.Type)
+	}
+	if cfg.PeriodMs < 0 {
+		return fmt.Errorf("period_ms must be positive, got %d", cfg.PeriodMs)
+	}
+	if cfg.MinBrightness < 0 || cfg.MinBrightness > 100 || cfg.MaxBrightness < 0 || cfg.MaxBrightness > 100 {
+		return fmt.Errorf("min_brightness and max_brightness must be 0-100")
+	}
+	if cfg.MaxBrightness != 0 && cfg.MinBrightness > cfg.MaxBrightness {
+		return fmt.Errorf("min_brightness %v is above max_brightness %v", cfg.MinBrightness, cfg.MaxBrightness)
+	}
+	if cfg.DurationS < 0 {
+		return fmt.Errorf("duration_s must be positive, got %v", cfg.DurationS)
+	}
+	for i, c := range cfg.Palette {
+		if _, _, err := parseColor(c); err != nil {
+			return fmt.Errorf("palette color %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// effect is a compiled EffectConfig bound to a set of lights.
+type effect struct {
+	kind     string
+	lights   []int
+	period   time.Duration
+	palette  [][]float32
+	minBri   uint8
+	maxBri   uint8
+	duration time.Duration
+	rnd      *rand.Rand
+}
+
+func newEffect(cfg *EffectConfig, lights []int) (*effect, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(lights) == 0 {
+		return nil, fmt.Errorf("effect %q needs at least one light", cfg.Type)
+	}
+
+	defaults := effectDefaults[cfg.Type]
+	e := &effect{
+		kind:     cfg.Type,
+		lights:   lights,
+		period:   time.Duration(cfg.PeriodMs) * time.Millisecond,
+		minBri:   percentToBri(10),
+		maxBri:   254,
+		duration: time.Duration(cfg.DurationS * float64(time.Second)),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if e.period == 0 {
+		e.period = time.Duration(defaults.periodMs) * time.Millisecond
+	}
+	if cfg.MinBrightness > 0 {
+		e.minBri = percentToBri(cfg.MinBrightness)
+	}
+	if cfg.MaxBrightness > 0 {
+		e.maxBri = percentToBri(cfg.MaxBrightness)
+	}
+	// A max_brightness below the default minimum brings the minimum down with it.
+	e.minBri = min(e.minBri, e.maxBri)
+
+	palette := cfg.Palette
+	if len(palette) == 0 {
+		palette = defaults.palette
+	}
+	for _, c := range palette {
+		x, y, err := parseColor(c)
+		if err != nil {
+			return nil, err
+		}
+		e.palette = append(e.palette, []float32{x, y})
+	}
+	return e, nil
+}
+
+// percentToBri maps a 0-100 brightness percentage to Hue Bri 1-254.
+func percentToBri(p float64) uint8 {
+	return max(uint8(math.Round(p/100*254)), 1)
+}
+
+// tick is the time between frames. It is stretched when there are too many
+// lights to update each frame within the bridge's command rate.
+func (e *effect) tick() time.Duration {
+	var t time.Duration
+	switch e.kind {
+	case "breathe", "strobe", "police":
+		t = e.period / 2
+	case "chase":
+		t = e.period / time.Duration(len(e.lights))
+	case "rainbow":
+		t = e.period / rainbowSteps
+	default:
+		t = e.period
+	}
+	return max(t, time.Duration(len(e.lights))*time.Second/bridgeCommandsPerSecond)
+}
+
+func (e *effect) color(i int) []float32 {
+	if len(e.palette) == 0 {
+		return nil
+	}
+	return e.palette[i%len(e.palette)]
+}
+
+func (e *effect) randomBri() uint8 {
+	return e.minBri + uint8(e.rnd.Intn(int(e.maxBri-e.minBri)+1))
+}
+
+// frame returns the state for each light at the given step, and the
+// transition time to use for the frame.
+func (e *effect) frame(step int) ([]huego.State, int) {
+	n := len(e.lights)
+	tickMs := int(e.tick() / time.Millisecond)
+	states := make([]huego.State, n)
+
+	switch e.kind {
+	case "breathe":
+		bri := e.maxBri
+		if step%2 == 1 {
+			bri = e.minBri
+		}
+		for i := range states {
+			states[i] = huego.State{On: true, Bri: bri, Xy: e.color(step / 2)}
+		}
+		return states, tickMs
+
+	case "strobe":
+		for i := range states {
+			if step%2 == 0 {
+				states[i] = huego.State{On: true, Bri: e.maxBri, Xy: e.color(step / 2)}
+			} else {
+				states[i] = huego.State{On: false}
+			}
+		}
+		return states, 0
+
+	case "police":
+		for i := range states {
+			states[i] = huego.State{On: true, Bri: e.maxBri, Xy: e.color(step + i)}
+		}
+		return states, 0
+
+	case "candle", "fire":
+		for i := range states {
+			states[i] = huego.State{On: true, Bri: e.randomBri(), Xy: e.color(e.rnd.Intn(max(len(e.palette), 1)))}
+		}
+		return states, tickMs
+
+	case "lightning":
+		for i := range states {
+			bri := e.minBri
+			if e.rnd.Float64() < lightningFlashChance {
+				bri = e.maxBri
+			}
+			states[i] = huego.State{On: true, Bri: bri, Xy: e.color(0)}
+		}
+		return states, 0
+
+	case "chase":
+		lit := step % n
+		for i := range states {
+			bri := e.minBri
+			if i == lit {
+				bri = e.maxBri
+			}
+			states[i] = huego.State{On: true, Bri: bri, Xy: e.color(step / n)}
+		}
+		return states, tickMs / 2
+
+	case "rainbow":
+		for i := range states {
+			hue := uint16((step*65536/rainbowSteps + i*65536/n) % 65536)
+			// hue 0 is dropped by omitempty, 1 is visually identical
+			states[i] = huego.State{On: true, Bri: e.maxBri, Hue: max(hue, 1), Sat: 254}
+		}
+		return states, tickMs
+	}
+	return states, transitionDefault
+}
+
+func (e *effect) category() string       { return "effect" }
+func (e *effect) name() string           { return e.kind }
+func (e *effect) lightIDs() []int        { return e.lights }
+func (e *effect) timeout() time.Duration { return e.duration }
+
+func (e *effect) status() map[string]interface{} {
+	return map[string]interface{}{"period_ms": int(e.period / time.Millisecond)}
+}
+
+// run renders frames until ctx is done.
+func (e *effect) run(ctx context.Context, bridge *huego.Bridge, logger logging.Logger) {
+	tick := e.tick()
+	for step := 0; ; step++ {
+		states, transitionMs := e.frame(step)
+		for i, id := range e.lights {
+			if step == 0 && states[i].On {
+				// a colorloop left over from a dance mode would override every frame
+				states[i].Effect = "none"
+			}
+			if err := setLightState(ctx, bridge, id, states[i], transitionMs); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				// one unreachable bulb should not stop the rest of the animation
+				logger.Debugf("effect %s: failed to update light %d: %v", e.kind, id, err)
+			}
+		}
+		if sleepCtx(ctx, tick) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package hue
+
+import "testing"
+
+func TestEffectRandomBri(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max float64
+	}{
+		{"defaults", 0, 0},
+		{"range", 20, 60},
+		{"equal", 50, 50},
+		{"max below default min", 0, 5},
+		{"max one percent", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newEffect(&EffectConfig{Type: "candle", MinBrightness: tt.min, MaxBrightness: tt.max}, []int{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.minBri > e.maxBri {
+				t.Fatalf("min brightness %d is above max %d", e.minBri, e.maxBri)
+			}
+			for i := 0; i < 1000; i++ {
+				if bri := e.randomBri(); bri < e.minBri || bri > e.maxBri {
+					t.Fatalf("randomBri() = %d, want %d-%d", bri, e.minBri, e.maxBri)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ go 1.25.1
 require (
 	github.com/amimof/huego v1.2.1
 	go.viam.com/rdk v0.103.0
+	golang.org/x/time v0.6.0
 )
 
 require (
@@ -158,7 +159,6 @@ require (
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
-	golang.org/x/time v0.6.0 // indirect
 	golang.org/x/tools v0.36.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 	gonum.org/v1/gonum v0.16.0 // indirect
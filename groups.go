@@ -0,0 +1,161 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// moduleGroupPrefix starts the names of the LightGroups the module creates
+// for group actions. Each name goes on with a hash of the component that
+// created it, so leftovers from its earlier runs can be recognized and reused
+// without touching another component's groups.
+const moduleGroupPrefix = "viam-mode-"
+
+// groupCheckInterval is how long a cached group is used before its members
+// are read again, since rooms and zones can be edited in the Hue app.
+const groupCheckInterval = 30 * time.Second
+
+// groupCache finds a bridge group containing exactly a given set of lights,
+// creating a module-owned LightGroup when no room or zone matches.
+type groupCache struct {
+	bridge *huego.Bridge
+	prefix string // names of the groups this component creates
+
+	mu    sync.Mutex
+	ids   map[string]cachedGroup // light set key -> group
+	owned map[int]bool           // groups this component created or adopted
+}
+
+// cachedGroup is a group found for a light set and when its members were
+// last confirmed.
+type cachedGroup struct {
+	id      int
+	checked time.Time
+}
+
+func newGroupCache(bridge *huego.Bridge, owner string) *groupCache {
+	return &groupCache{
+		bridge: bridge,
+		prefix: fmt.Sprintf("%s%08x-", moduleGroupPrefix, hash32(owner)),
+		ids:    map[string]cachedGroup{},
+		owned:  map[int]bool{},
+	}
+}
+
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// lightSetKey identifies a set of lights regardless of order.
+func lightSetKey(lights []int) string {
+	sorted := append([]int(nil), lights...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// groupFor returns a group with exactly the given lights.
+func (c *groupCache) groupFor(ctx context.Context, lights []int) (int, error) {
+	key := lightSetKey(lights)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.ids[key]; ok {
+		if time.Since(cached.checked) < groupCheckInterval {
+			return cached.id, nil
+		}
+		if g, err := c.bridge.GetGroupContext(ctx, cached.id); err == nil && lightSetKey(groupLights(g)) == key {
+			c.ids[key] = cachedGroup{id: cached.id, checked: time.Now()}
+			return cached.id, nil
+		}
+		delete(c.ids, key)
+	}
+
+	groups, err := c.bridge.GetGroupsContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list groups: %w", err)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	for _, g := range groups {
+		if g.Type == "Entertainment" {
+			continue // may be streaming; actions would fight the stream
+		}
+		if lightSetKey(groupLights(&g)) != key {
+			continue
+		}
+		ours := strings.HasPrefix(g.Name, c.prefix)
+		if !ours && strings.HasPrefix(g.Name, moduleGroupPrefix) {
+			continue // another component's, which may delete it at any time
+		}
+		c.ids[key] = cachedGroup{id: g.ID, checked: time.Now()}
+		if ours {
+			c.owned[g.ID] = true
+		}
+		return g.ID, nil
+	}
+
+	resp, err := c.bridge.CreateGroupContext(ctx, huego.Group{
+		Name:    fmt.Sprintf("%s%08x", c.prefix, hash32(key)),
+		Type:    "LightGroup",
+		Lights:  strings.Split(key, ","),
+		Recycle: true, // the bridge may delete it if it runs out of groups
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create group: %w", err)
+	}
+	idStr, _ := resp.Success["id"].(string)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, fmt.Errorf("bridge returned unexpected group id %v", resp.Success["id"])
+	}
+	c.ids[key] = cachedGroup{id: id, checked: time.Now()}
+	c.owned[id] = true
+	return id, nil
+}
+
+// groupLights returns the IDs of a group's lights.
+func groupLights(g *huego.Group) []int {
+	ids := make([]int, 0, len(g.Lights))
+	for _, l := range g.Lights {
+		if id, err := strconv.Atoi(l); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// forget drops a cached group, e.g. after an action on it failed because it
+// was deleted or recycled.
+func (c *groupCache) forget(lights []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.ids, lightSetKey(lights))
+}
+
+// cleanup deletes the groups this component owns, returning the first error.
+func (c *groupCache) cleanup(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for id := range c.owned {
+		if err := c.bridge.DeleteGroupContext(ctx, id); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete group %d: %w", id, err)
+		}
+	}
+	c.ids = map[string]cachedGroup{}
+	c.owned = map[int]bool{}
+	return firstErr
+}
@@ -0,0 +1,98 @@
+package hue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGroupFor(t *testing.T) {
+	owner := "mode"
+	ours := newGroupCache(nil, owner).prefix + "leftover"
+	tests := []struct {
+		name     string
+		groups   map[int]map[string]interface{}
+		lights   []int
+		want     int // 0 when a new group should be created
+		wantKept bool
+	}{
+		{"room", map[int]map[string]interface{}{
+			1: {"name": "Kitchen", "type": "Room", "lights": []interface{}{"2", "1"}},
+		}, []int{1, 2}, 1, false},
+		{"exact match only", map[int]map[string]interface{}{
+			1: {"name": "Kitchen", "type": "Room", "lights": []interface{}{"1", "2", "3"}},
+		}, []int{1, 2}, 0, false},
+		{"entertainment skipped", map[int]map[string]interface{}{
+			1: {"name": "TV", "type": "Entertainment", "lights": []interface{}{"1", "2"}},
+		}, []int{1, 2}, 0, false},
+		{"another component's group skipped", map[int]map[string]interface{}{
+			1: {"name": moduleGroupPrefix + "00000000-x", "type": "LightGroup", "lights": []interface{}{"1", "2"}},
+		}, []int{1, 2}, 0, false},
+		{"own leftover adopted", map[int]map[string]interface{}{
+			1: {"name": ours, "type": "LightGroup", "lights": []interface{}{"1", "2"}},
+		}, []int{1, 2}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			for id, g := range tt.groups {
+				f.groups[id] = g
+			}
+			c := newGroupCache(f.Bridge, owner)
+			id, err := c.groupFor(context.Background(), tt.lights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created := len(f.writes("/groups")) > 0
+			if tt.want == 0 {
+				if !created || tt.groups[id] != nil || !c.owned[id] {
+					t.Errorf("groupFor = %d, want a new group", id)
+				}
+				return
+			}
+			if id != tt.want || created {
+				t.Errorf("groupFor = %d (created %v), want %d", id, created, tt.want)
+			}
+			if c.owned[id] != tt.wantKept {
+				t.Errorf("owned = %v, want %v", c.owned[id], tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestGroupForRechecksCachedGroup(t *testing.T) {
+	f := newFakeBridge(t)
+	f.groups[1] = map[string]interface{}{"name": "Kitchen", "type": "Room", "lights": []interface{}{"1", "2"}}
+	c := newGroupCache(f.Bridge, "mode")
+	ctx := context.Background()
+	if id, err := c.groupFor(ctx, []int{1, 2}); err != nil || id != 1 {
+		t.Fatalf("groupFor = %d, %v, want 1", id, err)
+	}
+
+	// A room edited in the app is used until the next check.
+	f.mu.Lock()
+	f.groups[1]["lights"] = []interface{}{"1", "2", "3"}
+	f.mu.Unlock()
+	if id, err := c.groupFor(ctx, []int{1, 2}); err != nil || id != 1 {
+		t.Fatalf("groupFor = %d, %v, want the cached 1", id, err)
+	}
+
+	key := lightSetKey([]int{1, 2})
+	c.ids[key] = cachedGroup{id: 1, checked: time.Now().Add(-groupCheckInterval)}
+	id, err := c.groupFor(ctx, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 1 || !c.owned[id] {
+		t.Errorf("groupFor = %d after the room changed, want a new group", id)
+	}
+
+	// A group that still matches is kept and checked again later.
+	c.ids[key] = cachedGroup{id: id, checked: time.Now().Add(-groupCheckInterval)}
+	if again, err := c.groupFor(ctx, []int{1, 2}); err != nil || again != id {
+		t.Errorf("groupFor = %d, %v, want %d", again, err, id)
+	}
+	if time.Since(c.ids[key].checked) > time.Second {
+		t.Error("check time was not refreshed")
+	}
+}
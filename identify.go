@@ -0,0 +1,201 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// Limits for the blink identify pattern, so a typo cannot tie up a light for minutes.
+const (
+	maxBlinkCount     = 20
+	maxBlinkPhaseMs   = 5000
+	defaultBlinkMs    = 500
+	blinkTransitionMs = 100
+)
+
+// identifyLight handles the identify DoCommand shared by every per-light model.
+//
+//	{"identify": true}                                        one breathe cycle (alert "select")
+//	{"identify": "lselect"}                                   breathe for 15 seconds; "none" stops it
+//	{"identify": {"blink": 3, "on_ms": 500, "off_ms": 500}}   blink, then restore the original state
+func identifyLight(ctx context.Context, bridge *huego.Bridge, lightID int, arg interface{}) (map[string]interface{}, error) {
+	switch v := arg.(type) {
+	case bool, nil:
+		return setAlert(ctx, bridge, lightID, "select")
+	case string:
+		return setAlert(ctx, bridge, lightID, v)
+	case map[string]interface{}:
+		if alert, ok := v["alert"].(string); ok {
+			return setAlert(ctx, bridge, lightID, alert)
+		}
+		if _, ok := v["blink"]; ok {
+			return blinkLight(ctx, bridge, lightID, v)
+		}
+	}
+	return nil, fmt.Errorf("identify expects true, an alert name, or {\"blink\": count}")
+}
+
+// alertDurations is how long the bridge runs each alert.
+var alertDurations = map[string]time.Duration{
+	"select":  2 * time.Second,
+	"lselect": 15 * time.Second,
+	"none":    0,
+}
+
+var (
+	alertLitMu sync.Mutex
+	alertLit   = map[string]*time.Timer{} // bridge/light ID -> turns off a light that was off before its alert
+)
+
+// setAlert runs a bridge alert on a light. An off light does not flash, so it
+// is turned on for the alert and off again once the alert ends or is stopped.
+func setAlert(ctx context.Context, bridge *huego.Bridge, lightID int, alert string) (map[string]interface{}, error) {
+	duration, ok := alertDurations[alert]
+	if !ok {
+		return nil, fmt.Errorf("alert must be \"select\", \"lselect\", or \"none\", got %q", alert)
+	}
+
+	light, err := bridge.GetLightContext(ctx, lightID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get light state: %w", err)
+	}
+	key := commandedKey(bridge, lightID)
+	alertLitMu.Lock()
+	timer, lit := alertLit[key]
+	if lit {
+		timer.Stop()
+		delete(alertLit, key)
+	}
+	alertLitMu.Unlock()
+
+	if alert == "none" && lit {
+		if err := setLightState(ctx, bridge, lightID, huego.State{On: false}, transitionDefault); err != nil {
+			return nil, fmt.Errorf("failed to turn off light %d after its alert: %w", lightID, err)
+		}
+		return map[string]interface{}{"light_id": lightID, "alert": alert}, nil
+	}
+
+	// Bri is carried over so the alert does not change it, and On always
+	// needs a value: the field has no omitempty.
+	state := huego.State{On: light.State.On, Bri: light.State.Bri, Alert: alert}
+	turnOn := !state.On && alert != "none"
+	if turnOn {
+		state.On = true
+	}
+	if err := setLightState(ctx, bridge, lightID, state, transitionDefault); err != nil {
+		return nil, fmt.Errorf("failed to set alert on light %d: %w", lightID, err)
+	}
+	if turnOn || lit {
+		offCtx := context.WithoutCancel(ctx)
+		alertLitMu.Lock()
+		var t *time.Timer
+		t = time.AfterFunc(duration, func() {
+			alertLitMu.Lock()
+			current := alertLit[key] == t
+			if current {
+				delete(alertLit, key)
+			}
+			alertLitMu.Unlock()
+			if !current {
+				return // a newer alert took over
+			}
+			ctx, cancel := context.WithTimeout(offCtx, restoreTimeout)
+			defer cancel()
+			setLightState(ctx, bridge, lightID, huego.State{On: false}, transitionDefault)
+		})
+		alertLit[key] = t
+		alertLitMu.Unlock()
+	}
+	return map[string]interface{}{"light_id": lightID, "alert": alert}, nil
+}
+
+// blinkLight toggles the light on and off, then puts back its original on/off
+// state and brightness.
+func blinkLight(ctx context.Context, bridge *huego.Bridge, lightID int, args map[string]interface{}) (map[string]interface{}, error) {
+	count, err := intArg(args["blink"])
+	if err != nil {
+		return nil, fmt.Errorf("blink count: %w", err)
+	}
+	if count < 1 || count > maxBlinkCount {
+		return nil, fmt.Errorf("blink count must be 1-%d, got %d", maxBlinkCount, count)
+	}
+	onMs, err := blinkPhase(args, "on_ms")
+	if err != nil {
+		return nil, err
+	}
+	offMs, err := blinkPhase(args, "off_ms")
+	if err != nil {
+		return nil, err
+	}
+
+	light, err := bridge.GetLightContext(ctx, lightID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get light state: %w", err)
+	}
+	original := *light.State
+
+	bri := original.Bri
+	if bri == 0 {
+		bri = 254
+	}
+
+	var blinkErr error
+	for i := 0; i < count && blinkErr == nil; i++ {
+		if blinkErr = setLightState(ctx, bridge, lightID, huego.State{On: false}, blinkTransitionMs); blinkErr != nil {
+			break
+		}
+		if blinkErr = sleepCtx(ctx, offMs); blinkErr != nil {
+			break
+		}
+		if blinkErr = setLightState(ctx, bridge, lightID, huego.State{On: true, Bri: bri}, blinkTransitionMs); blinkErr != nil {
+			break
+		}
+		blinkErr = sleepCtx(ctx, onMs)
+	}
+
+	// Restore even if the blink was interrupted, using a context that is not
+	// cancelled with the request so it does not leave the light dark.
+	restore := huego.State{On: false}
+	if original.On {
+		restore = huego.State{On: true, Bri: bri}
+	}
+	restoreErr := setLightState(context.WithoutCancel(ctx), bridge, lightID, restore, transitionDefault)
+	if blinkErr != nil {
+		return nil, fmt.Errorf("failed to blink light %d: %w", lightID, blinkErr)
+	}
+	if restoreErr != nil {
+		return nil, fmt.Errorf("failed to restore light %d after blinking: %w", lightID, restoreErr)
+	}
+	return map[string]interface{}{"light_id": lightID, "blinks": count}, nil
+}
+
+func blinkPhase(args map[string]interface{}, key string) (time.Duration, error) {
+	v, ok := args[key]
+	if !ok {
+		return defaultBlinkMs * time.Millisecond, nil
+	}
+	ms, err := intArg(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if ms < 0 || ms > maxBlinkPhaseMs {
+		return 0, fmt.Errorf("%s must be 0-%d, got %d", key, maxBlinkPhaseMs, ms)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package hue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+func TestIdentifyLight(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     interface{}
+		state   map[string]interface{}
+		writes  int
+		wantErr bool
+	}{
+		{"select", true, map[string]interface{}{"on": true, "bri": 100}, 1, false},
+		{"lselect", "lselect", map[string]interface{}{"on": true, "bri": 100}, 1, false},
+		{"alert map", map[string]interface{}{"alert": "none"}, map[string]interface{}{"on": true, "bri": 100}, 1, false},
+		{"unknown alert", "flash", nil, 0, true},
+		{"blink", map[string]interface{}{"blink": 2.0, "on_ms": 0.0, "off_ms": 0.0}, map[string]interface{}{"on": true, "bri": 254}, 5, false},
+		{"blink count too high", map[string]interface{}{"blink": 50.0}, nil, 0, true},
+		{"blink phase too long", map[string]interface{}{"blink": 1.0, "on_ms": 10000.0}, nil, 0, true},
+		{"bad argument", 3.0, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, tt.state)
+			registerLimits(f.Bridge, "test", []int{1}, &LightLimits{MaxBrightness: 50}, logging.NewTestLogger(t))
+			defer unregisterLimits(f.Bridge, "test")
+
+			_, err := identifyLight(context.Background(), f.Bridge, 1, tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("identifyLight error = %v, want error %v", err, tt.wantErr)
+			}
+			writes := f.writes("/lights/1/state")
+			if len(writes) != tt.writes {
+				t.Fatalf("%d writes, want %d", len(writes), tt.writes)
+			}
+			for _, w := range writes {
+				if bri, ok := w.body["bri"].(float64); ok && bri > float64(percentToBri(50)) {
+					t.Errorf("write %v is past the brightness limit", w.body)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertTurnsOffLightBackOff(t *testing.T) {
+	tests := []struct {
+		name   string
+		stop   bool // send "none" instead of waiting for the alert to end
+		wasOn  bool
+		wantOn bool
+	}{
+		{"alert ends", false, false, false},
+		{"alert stopped", true, false, false},
+		{"light was on", false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, map[string]interface{}{"on": tt.wasOn, "bri": 100})
+			defer func(d time.Duration) { alertDurations["select"] = d }(alertDurations["select"])
+			alertDurations["select"] = 20 * time.Millisecond
+			if tt.stop {
+				alertDurations["select"] = time.Hour
+			}
+
+			if _, err := setAlert(context.Background(), f.Bridge, 1, "select"); err != nil {
+				t.Fatal(err)
+			}
+			if on := f.state(1)["on"]; on != true {
+				t.Fatalf("light on = %v during the alert, want true", on)
+			}
+			if tt.stop {
+				if _, err := setAlert(context.Background(), f.Bridge, 1, "none"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+			if on := f.state(1)["on"]; on != tt.wantOn {
+				t.Errorf("light on = %v after the alert, want %v", on, tt.wantOn)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sync"
 
 	"github.com/amimof/huego"
 	toggleswitch "go.viam.com/rdk/components/switch"
@@ -25,8 +26,45 @@ type LightBrightnessConfig struct {
 	BridgeHost string `json:"bridge_host,omitempty"`
 	Username   string `json:"username"`
 	LightID    int    `json:"light_id"`
+
+	// TransitionMs is the default fade for SetPosition; extra["transition_ms"]
+	// overrides it per call. Unset uses the bridge default of 400 ms.
+	TransitionMs *int `json:"transition_ms,omitempty"`
+
+	// Reconcile re-applies the last commanded state when the light comes back
+	// from a power cut or is changed elsewhere. Unset leaves the light alone.
+	Reconcile *ReconcileConfig `json:"reconcile,omitempty"`
+
+	// MaxUpdatesPerS caps how often SetPosition writes the light; calls that
+	// arrive faster are combined into the next write. Default 5.
+	MaxUpdatesPerS float64 `json:"max_updates_per_s,omitempty"`
+
+	// Limits bound every state the module sets on the light.
+	Limits *LightLimits `json:"limits,omitempty"`
+
+	// Arbitration sets how the component competes with others writing the
+	// same light. By default it holds the light against lower priorities for
+	// 5 minutes after each change.
+	Arbitration *ArbitrationConfig `json:"arbitration,omitempty"`
+
+	// BrightnessCurve shapes how the brightness levels map to the light's
+	// output. Unset is linear.
+	BrightnessCurve *BrightnessCurve `json:"brightness_curve,omitempty"`
+
+	// Steps is the number of brightness levels above off, default 99.
+	// LastLevelPosition keeps position 1 as "on at the last level set", with
+	// the levels after it; it defaults to true. Labels names every position,
+	// starting with off.
+	Steps             int      `json:"steps,omitempty"`
+	LastLevelPosition *bool    `json:"last_level_position,omitempty"`
+	Labels            []string `json:"labels,omitempty"`
 }
 
+const (
+	defaultBrightnessSteps = 99
+	maxBrightnessSteps     = 254 // one per Hue brightness value
+)
+
 func (cfg *LightBrightnessConfig) Validate(path string) ([]string, []string, error) {
 	if cfg.Username == "" {
 		return nil, nil, fmt.Errorf("need a username (API key) for the Hue bridge")
@@ -34,19 +72,57 @@ func (cfg *LightBrightnessConfig) Validate(path string) ([]string, []string, err
 	if cfg.LightID == 0 {
 		return nil, nil, fmt.Errorf("need a light_id")
 	}
+	if cfg.TransitionMs != nil {
+		if err := validateTransitionMs(*cfg.TransitionMs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Reconcile != nil {
+		if err := cfg.Reconcile.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.MaxUpdatesPerS < 0 || cfg.MaxUpdatesPerS > bridgeCommandsPerSecond {
+		return nil, nil, fmt.Errorf("max_updates_per_s must be 0-%d, got %v", bridgeCommandsPerSecond, cfg.MaxUpdatesPerS)
+	}
+	if cfg.Limits != nil {
+		if err := cfg.Limits.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Arbitration != nil {
+		if err := cfg.Arbitration.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.BrightnessCurve != nil {
+		if err := cfg.BrightnessCurve.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Steps < 0 || cfg.Steps > maxBrightnessSteps {
+		return nil, nil, fmt.Errorf("steps must be 1-%d, got %d", maxBrightnessSteps, cfg.Steps)
+	}
+	if n := cfg.numPositions(); len(cfg.Labels) > 0 && len(cfg.Labels) != int(n) {
+		return nil, nil, fmt.Errorf("labels must name all %d positions, got %d", n, len(cfg.Labels))
+	}
 	return nil, nil, nil
 }
 
 type hueLightBrightness struct {
 	resource.AlwaysRebuild
-	resource.TriviallyCloseable
 
 	name   resource.Name
 	logger logging.Logger
 	cfg    *LightBrightnessConfig
 
-	bridge  *huego.Bridge
-	lastBri uint8 // last brightness set via positions 2-100, used by position 1 to restore
+	bridge    *huego.Bridge
+	claim     *claimant
+	reconcile *reconciler // nil unless configured
+
+	mu      sync.Mutex
+	lastBri uint8  // last brightness level set, used by the last-level position
+	lastPos uint32 // last position set, preferred by GetPosition when it still matches
 }
 
 func newHueLightBrightness(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
@@ -71,6 +147,9 @@ func newHueLightBrightness(ctx context.Context, deps resource.Dependencies, rawC
 	if s.lastBri == 0 {
 		s.lastBri = 254
 	}
+	s.claim = newClaimant(s.name.String(), conf.Arbitration, priorityManual, defaultManualHold, logger)
+	s.reconcile = newReconciler(conf.Reconcile, s.bridge, s.claim, logger, nil)
+	registerLimits(s.bridge, s.name.String(), []int{conf.LightID}, conf.Limits, logger)
 
 	return s, nil
 }
@@ -79,58 +158,175 @@ func (s *hueLightBrightness) Name() resource.Name {
 	return s.name
 }
 
+func (s *hueLightBrightness) Close(ctx context.Context) error {
+	s.reconcile.close()
+	unregisterLimits(s.bridge, s.name.String())
+	s.claim.close(s.bridge)
+	return nil
+}
+
 func (s *hueLightBrightness) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if v, ok := cmd["identify"]; ok {
+		return identifyLight(withClaimant(ctx, s.claim), s.bridge, s.cfg.LightID, v)
+	}
+	if hasStep(cmd) {
+		return s.step(ctx, cmd)
+	}
+	if _, ok := cmd["limit_status"]; ok {
+		return map[string]interface{}{"violations": limitViolations(s.bridge, []int{s.cfg.LightID})}, nil
+	}
+	if _, ok := cmd["owner_status"]; ok {
+		return lightOwner(s.bridge, s.cfg.LightID), nil
+	}
 	return nil, nil
 }
 
-// SetPosition controls on/off and brightness.
-// 0 = off. 1 = on at last-set brightness. 2-100 map to brightness levels (Hue Bri 1-254).
-func (s *hueLightBrightness) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
-	if position > 100 {
-		return fmt.Errorf("position must be 0-100, got %d", position)
+// step applies a relative change such as {"bri_inc": 25} and returns the
+// light's new state.
+func (s *hueLightBrightness) step(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	body, err := stepBody(cmd)
+	if err != nil {
+		return nil, err
 	}
-
-	light, err := s.bridge.GetLight(s.cfg.LightID)
+	fade, err := transitionArg(cmd, s.cfg.TransitionMs)
 	if err != nil {
-		return fmt.Errorf("failed to get light state: %w", err)
+		return nil, err
+	}
+	if ok, err := s.claim.acquire(s.bridge, []int{s.cfg.LightID}, func(ctx context.Context) error {
+		_, err := s.step(ctx, cmd)
+		return err
+	}); !ok {
+		return deferredResult(err)
 	}
+	st, err := stepLight(ctx, s.bridge, s.cfg.LightID, body, fade)
+	if err != nil {
+		return nil, err
+	}
+	if st.On && st.Bri > 0 {
+		s.mu.Lock()
+		s.lastBri = st.Bri
+		s.mu.Unlock()
+	}
+	s.reconcile.set(s.cfg.LightID, huego.State{On: st.On, Bri: st.Bri}, fade)
+	return stateToMap(st), nil
+}
 
-	if position == 0 {
-		return light.SetState(huego.State{On: false})
+// SetPosition controls on/off and brightness. 0 = off. With the last-level
+// position, 1 = on at the last level set and the levels follow from 2;
+// otherwise the levels start at 1. Levels map through brightness_curve to Hue
+// Bri 1-254, the last level being full brightness.
+// extra["transition_ms"] sets the fade for this call, 0 for an instant change.
+func (s *hueLightBrightness) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	if n := s.cfg.numPositions(); position >= n {
+		return fmt.Errorf("position must be 0-%d, got %d", n-1, position)
+	}
+	fade, err := transitionArg(extra, s.cfg.TransitionMs)
+	if err != nil {
+		return err
 	}
-	if position == 1 {
-		return light.SetState(huego.State{On: true, Bri: s.lastBri})
+	if ok, err := s.claim.acquire(s.bridge, []int{s.cfg.LightID}, func(ctx context.Context) error {
+		return s.SetPosition(ctx, position, extra)
+	}); !ok {
+		return err
 	}
+	ctx = withClaimant(ctx, s.claim)
 
-	// Map 2-100 linearly to Hue brightness range 1-254.
-	bri := max(uint8(math.Round(float64(position-2)/98.0*253.0)), 1)
-	s.lastBri = bri
-	return light.SetState(huego.State{On: true, Bri: bri})
+	var state huego.State
+	s.mu.Lock()
+	switch {
+	case position == 0:
+		state = huego.State{On: false}
+	case position < s.cfg.firstLevel():
+		state = huego.State{On: true, Bri: s.lastBri}
+	default:
+		bri := s.briForPosition(position)
+		s.lastBri = bri
+		state = huego.State{On: true, Bri: bri}
+	}
+	s.mu.Unlock()
+
+	sent, err := writerFor(s.bridge, s.cfg.LightID).update(ctx, func(huego.State) huego.State { return state }, false, fade, s.cfg.MaxUpdatesPerS)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.lastPos = position
+	s.mu.Unlock()
+	s.reconcile.set(s.cfg.LightID, sent, fade)
+	return nil
 }
 
+// GetPosition returns 0 when the light is off, the last position set while
+// the light still shows it, and otherwise the level closest to its brightness.
 func (s *hueLightBrightness) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
 	light, err := s.bridge.GetLight(s.cfg.LightID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get light state: %w", err)
 	}
+	state := effectiveState(s.bridge, s.cfg.LightID, light.State)
 
-	if !light.State.On {
+	if !state.On {
 		return 0, nil
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.positionForBri(state.Bri), nil
+}
+
+func (s *hueLightBrightness) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	return s.cfg.numPositions(), s.cfg.Labels, nil
+}
 
-	if light.State.Bri >= 254 {
-		return 1, nil
+func (cfg *LightBrightnessConfig) steps() int {
+	if cfg.Steps == 0 {
+		return defaultBrightnessSteps
 	}
+	return cfg.Steps
+}
 
-	// Map Hue brightness 1-253 back to position 2-100.
-	pos := uint32(math.Round(float64(light.State.Bri)/253.0*98.0)) + 2
-	if pos > 100 {
-		pos = 100
+// firstLevel is the position of the dimmest level.
+func (cfg *LightBrightnessConfig) firstLevel() uint32 {
+	if cfg.LastLevelPosition == nil || *cfg.LastLevelPosition {
+		return 2
 	}
-	return pos, nil
+	return 1
 }
 
-func (s *hueLightBrightness) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
-	// 0 = off, 1-100 = brightness levels
-	return 101, nil, nil
+func (cfg *LightBrightnessConfig) numPositions() uint32 {
+	return cfg.firstLevel() + uint32(cfg.steps())
+}
+
+// briForPosition maps a level position through the brightness curve onto Hue
+// brightness 1-254.
+func (s *hueLightBrightness) briForPosition(position uint32) uint8 {
+	t := 1.0
+	if steps := s.cfg.steps(); steps > 1 {
+		t = float64(position-s.cfg.firstLevel()) / float64(steps-1)
+	}
+	return 1 + uint8(math.Round(s.cfg.BrightnessCurve.apply(t)*253.0))
+}
+
+// positionForBri returns the position showing bri: the last position set if
+// it still matches, which keeps round-trips stable where a steep curve gives
+// several levels the same brightness, otherwise the closest level. s.mu must
+// be held.
+func (s *hueLightBrightness) positionForBri(bri uint8) uint32 {
+	first := s.cfg.firstLevel()
+	switch {
+	case s.lastPos == 0:
+	case s.lastPos < first:
+		if bri == s.lastBri {
+			return s.lastPos
+		}
+	case s.briForPosition(s.lastPos) == bri:
+		return s.lastPos
+	}
+
+	best, bestDiff := first, math.Inf(1)
+	for p := first; p < s.cfg.numPositions(); p++ {
+		if d := math.Abs(float64(s.briForPosition(p)) - float64(bri)); d < bestDiff {
+			best, bestDiff = p, d
+		}
+	}
+	return best
 }
@@ -0,0 +1,49 @@
+package hue
+
+import "testing"
+
+func TestBrightnessPositionRoundTrip(t *testing.T) {
+	noLastLevel := false
+	tests := []struct {
+		name string
+		cfg  LightBrightnessConfig
+	}{
+		{"defaults", LightBrightnessConfig{}},
+		{"few steps", LightBrightnessConfig{Steps: 5}},
+		{"one step", LightBrightnessConfig{Steps: 1}},
+		{"every value", LightBrightnessConfig{Steps: maxBrightnessSteps}},
+		{"no last level", LightBrightnessConfig{Steps: 10, LastLevelPosition: &noLastLevel}},
+		{"gamma", LightBrightnessConfig{Steps: 50, BrightnessCurve: &BrightnessCurve{Type: "gamma"}}},
+		{"cie", LightBrightnessConfig{BrightnessCurve: &BrightnessCurve{Type: "cie"}}},
+		{"lut", LightBrightnessConfig{Steps: 20, BrightnessCurve: &BrightnessCurve{Type: "lut", Table: []float64{0, 5, 100}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			s := &hueLightBrightness{cfg: &cfg}
+			first := cfg.firstLevel()
+			if bri := s.briForPosition(cfg.numPositions() - 1); bri != 254 {
+				t.Errorf("top position gives bri %d, want 254", bri)
+			}
+			prev := uint8(0)
+			for p := first; p < cfg.numPositions(); p++ {
+				bri := s.briForPosition(p)
+				if bri < prev {
+					t.Fatalf("position %d gives bri %d, below %d at the position before", p, bri, prev)
+				}
+				prev = bri
+
+				// GetPosition after SetPosition reports the same position
+				s.lastPos = p
+				if got := s.positionForBri(bri); got != p {
+					t.Errorf("position %d: bri %d reads back as position %d", p, bri, got)
+				}
+				// without a last position, the closest level shows the same bri
+				s.lastPos = 0
+				if got := s.briForPosition(s.positionForBri(bri)); got != bri {
+					t.Errorf("position %d: bri %d reads back as bri %d", p, bri, got)
+				}
+			}
+		})
+	}
+}
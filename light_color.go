@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 
 	"github.com/amimof/huego"
 	toggleswitch "go.viam.com/rdk/components/switch"
@@ -26,6 +28,26 @@ type LightColorConfig struct {
 	Username   string `json:"username"`
 	LightID    int    `json:"light_id"`
 	Channel    string `json:"channel"` // "red", "green", or "blue"
+
+	// TransitionMs is the default fade for SetPosition; extra["transition_ms"]
+	// overrides it per call. Unset uses the bridge default of 400 ms.
+	TransitionMs *int `json:"transition_ms,omitempty"`
+
+	// Reconcile re-applies the last commanded state when the light comes back
+	// from a power cut or is changed elsewhere. Unset leaves the light alone.
+	Reconcile *ReconcileConfig `json:"reconcile,omitempty"`
+
+	// MaxUpdatesPerS caps how often SetPosition writes the light; calls that
+	// arrive faster are combined into the next write. Default 5.
+	MaxUpdatesPerS float64 `json:"max_updates_per_s,omitempty"`
+
+	// Limits bound every state the module sets on the light.
+	Limits *LightLimits `json:"limits,omitempty"`
+
+	// Arbitration sets how the component competes with others writing the
+	// same light. By default it holds the light against lower priorities for
+	// 5 minutes after each change.
+	Arbitration *ArbitrationConfig `json:"arbitration,omitempty"`
 }
 
 func (cfg *LightColorConfig) Validate(path string) ([]string, []string, error) {
@@ -40,18 +62,42 @@ func (cfg *LightColorConfig) Validate(path string) ([]string, []string, error) {
 	default:
 		return nil, nil, fmt.Errorf("channel must be \"red\", \"green\", or \"blue\", got %q", cfg.Channel)
 	}
+	if cfg.TransitionMs != nil {
+		if err := validateTransitionMs(*cfg.TransitionMs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Reconcile != nil {
+		if err := cfg.Reconcile.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.MaxUpdatesPerS < 0 || cfg.MaxUpdatesPerS > bridgeCommandsPerSecond {
+		return nil, nil, fmt.Errorf("max_updates_per_s must be 0-%d, got %v", bridgeCommandsPerSecond, cfg.MaxUpdatesPerS)
+	}
+	if cfg.Limits != nil {
+		if err := cfg.Limits.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Arbitration != nil {
+		if err := cfg.Arbitration.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
 	return nil, nil, nil
 }
 
 type hueLightColor struct {
 	resource.AlwaysRebuild
-	resource.TriviallyCloseable
 
 	name   resource.Name
 	logger logging.Logger
 	cfg    *LightColorConfig
 
-	bridge *huego.Bridge
+	bridge    *huego.Bridge
+	claim     *claimant
+	reconcile *reconciler // nil unless configured
 }
 
 func newHueLightColor(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
@@ -70,6 +116,9 @@ func newHueLightColor(ctx context.Context, deps resource.Dependencies, rawConf r
 	if err != nil {
 		return nil, err
 	}
+	s.claim = newClaimant(s.name.String(), conf.Arbitration, priorityManual, defaultManualHold, logger)
+	s.reconcile = newReconciler(conf.Reconcile, s.bridge, s.claim, logger, nil)
+	registerLimits(s.bridge, s.name.String(), []int{conf.LightID}, conf.Limits, logger)
 
 	return s, nil
 }
@@ -78,57 +127,111 @@ func (s *hueLightColor) Name() resource.Name {
 	return s.name
 }
 
+func (s *hueLightColor) Close(ctx context.Context) error {
+	s.reconcile.close()
+	unregisterLimits(s.bridge, s.name.String())
+	s.claim.close(s.bridge)
+	return nil
+}
+
 func (s *hueLightColor) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if v, ok := cmd["identify"]; ok {
+		return identifyLight(withClaimant(ctx, s.claim), s.bridge, s.cfg.LightID, v)
+	}
+	if hasStep(cmd) {
+		return s.step(ctx, cmd)
+	}
+	if _, ok := cmd["limit_status"]; ok {
+		return map[string]interface{}{"violations": limitViolations(s.bridge, []int{s.cfg.LightID})}, nil
+	}
+	if _, ok := cmd["owner_status"]; ok {
+		return lightOwner(s.bridge, s.cfg.LightID), nil
+	}
 	return map[string]interface{}{}, nil
 }
 
+// step applies a relative change such as {"ct_inc": 30} and returns the
+// light's new state.
+func (s *hueLightColor) step(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	body, err := stepBody(cmd)
+	if err != nil {
+		return nil, err
+	}
+	fade, err := transitionArg(cmd, s.cfg.TransitionMs)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := s.claim.acquire(s.bridge, []int{s.cfg.LightID}, func(ctx context.Context) error {
+		_, err := s.step(ctx, cmd)
+		return err
+	}); !ok {
+		return deferredResult(err)
+	}
+	st, err := stepLight(ctx, s.bridge, s.cfg.LightID, body, fade)
+	if err != nil {
+		return nil, err
+	}
+	s.reconcile.set(s.cfg.LightID, commandFromState(st), fade)
+	return stateToMap(st), nil
+}
+
 // SetPosition sets the configured RGB channel to the given value.
 // Position maps 1-to-1 to the channel value (0–255).
+// extra["transition_ms"] sets the fade for this call, 0 for an instant change.
 func (s *hueLightColor) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
 	if position > 255 {
 		return fmt.Errorf("position must be 0–255, got %d", position)
 	}
-
-	light, err := s.bridge.GetLight(s.cfg.LightID)
+	fade, err := transitionArg(extra, s.cfg.TransitionMs)
 	if err != nil {
-		return fmt.Errorf("failed to get light state: %w", err)
+		return err
 	}
-
-	r, g, b := xyBriToRGB(light.State.Xy, light.State.Bri)
-
-	channelValue := uint8(position)
-	switch s.cfg.Channel {
-	case "red":
-		r = channelValue
-	case "green":
-		g = channelValue
-	case "blue":
-		b = channelValue
+	if ok, err := s.claim.acquire(s.bridge, []int{s.cfg.LightID}, func(ctx context.Context) error {
+		return s.SetPosition(ctx, position, extra)
+	}); !ok {
+		return err
 	}
+	ctx = withClaimant(ctx, s.claim)
 
-	maxChan := maxUint8(r, g, b)
-	if maxChan == 0 {
-		if err := light.SetState(huego.State{On: false}); err != nil {
-			return fmt.Errorf("failed to turn off light: %w", err)
-		}
-		return nil
+	// The other channels are read when the write is sent, after any changes
+	// queued before it, so quick changes to several channels build on each other.
+	sent, err := writerFor(s.bridge, s.cfg.LightID).update(ctx, s.withChannel(uint8(position)), true, fade, s.cfg.MaxUpdatesPerS)
+	if err != nil {
+		return fmt.Errorf("failed to set color: %w", err)
 	}
+	s.reconcile.set(s.cfg.LightID, sent, fade)
+	return nil
+}
 
-	bri := maxChan
-	if bri > 254 {
-		bri = 254
-	}
+// withChannel returns a change setting the configured channel of the light's
+// current color, turning the light off when every channel is 0.
+func (s *hueLightColor) withChannel(value uint8) lightChange {
+	return func(current huego.State) huego.State {
+		r, g, b := xyBriToRGB(current.Xy, current.Bri)
+		switch s.cfg.Channel {
+		case "red":
+			r = value
+		case "green":
+			g = value
+		case "blue":
+			b = value
+		}
 
-	x, y := rgbToXY(r, g, b)
-	if err := light.SetState(huego.State{
-		On:  true,
-		Xy:  []float32{x, y},
-		Bri: bri,
-	}); err != nil {
-		return fmt.Errorf("failed to set color: %w", err)
+		maxChan := maxUint8(r, g, b)
+		if maxChan == 0 {
+			return huego.State{On: false}
+		}
+		bri := maxChan
+		if bri > 254 {
+			bri = 254
+		}
+		x, y := rgbToXY(r, g, b)
+		return huego.State{
+			On:  true,
+			Xy:  []float32{x, y},
+			Bri: bri,
+		}
 	}
-
-	return nil
 }
 
 // GetPosition returns the current value of the configured RGB channel (0–255).
@@ -137,12 +240,13 @@ func (s *hueLightColor) GetPosition(ctx context.Context, extra map[string]interf
 	if err != nil {
 		return 0, fmt.Errorf("failed to get light state: %w", err)
 	}
+	state := effectiveState(s.bridge, s.cfg.LightID, light.State)
 
-	if !light.State.On {
+	if !state.On {
 		return 0, nil
 	}
 
-	r, g, b := xyBriToRGB(light.State.Xy, light.State.Bri)
+	r, g, b := xyBriToRGB(state.Xy, state.Bri)
 
 	var channelValue uint8
 	switch s.cfg.Channel {
@@ -258,3 +362,77 @@ func linearToSRGB8(c float64) uint8 {
 	}
 	return uint8(math.Round(math.Min(1, math.Max(0, out)) * 255))
 }
+
+// parseColor converts a color given in a DoCommand or config value to CIE xy.
+// Accepted forms are a hex string ("#ff8800" or "ff8800"), an [r, g, b] list
+// (0–255), an [x, y] list, or a map with either "x"/"y" or "r"/"g"/"b" keys.
+func parseColor(v interface{}) (x, y float32, err error) {
+	switch c := v.(type) {
+	case string:
+		r, g, b, err := parseHexColor(c)
+		if err != nil {
+			return 0, 0, err
+		}
+		x, y := rgbToXY(r, g, b)
+		return x, y, nil
+	case []interface{}:
+		vals := make([]float64, len(c))
+		for i, e := range c {
+			f, ok := e.(float64)
+			if !ok {
+				return 0, 0, fmt.Errorf("color component %v is not a number", e)
+			}
+			vals[i] = f
+		}
+		switch len(vals) {
+		case 2:
+			return float32(vals[0]), float32(vals[1]), nil
+		case 3:
+			x, y := rgbToXY(clampChannel(vals[0]), clampChannel(vals[1]), clampChannel(vals[2]))
+			return x, y, nil
+		}
+		return 0, 0, fmt.Errorf("color list must be [r, g, b] or [x, y], got %d values", len(vals))
+	case map[string]interface{}:
+		if xv, ok := c["x"].(float64); ok {
+			yv, ok := c["y"].(float64)
+			if !ok {
+				return 0, 0, fmt.Errorf("color map has \"x\" but no numeric \"y\"")
+			}
+			return float32(xv), float32(yv), nil
+		}
+		if hex, ok := c["hex"].(string); ok {
+			return parseColor(hex)
+		}
+		rv, rok := c["r"].(float64)
+		gv, gok := c["g"].(float64)
+		bv, bok := c["b"].(float64)
+		if !rok || !gok || !bok {
+			return 0, 0, fmt.Errorf("color map needs \"x\"/\"y\", \"hex\", or \"r\"/\"g\"/\"b\" keys")
+		}
+		x, y := rgbToXY(clampChannel(rv), clampChannel(gv), clampChannel(bv))
+		return x, y, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported color value %v", v)
+}
+
+// parseHexColor parses "#rrggbb" or "rrggbb".
+func parseHexColor(s string) (r, g, b uint8, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("hex color must be 6 digits, got %q", s)
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: %w", s, err)
+	}
+	return uint8(n >> 16), uint8(n >> 8), uint8(n), nil
+}
+
+// rgbToHex formats an RGB triple as "#rrggbb".
+func rgbToHex(r, g, b uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+func clampChannel(v float64) uint8 {
+	return uint8(math.Round(math.Min(255, math.Max(0, v))))
+}
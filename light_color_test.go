@@ -0,0 +1,46 @@
+package hue
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      interface{}
+		x, y    float32
+		wantErr bool
+	}{
+		{name: "xy list", in: []interface{}{0.3, 0.4}, x: 0.3, y: 0.4},
+		{name: "xy map", in: map[string]interface{}{"x": 0.5, "y": 0.25}, x: 0.5, y: 0.25},
+		{name: "hex", in: "#ff0000", x: 0.7006, y: 0.2993},
+		{name: "hex without hash", in: "ff0000", x: 0.7006, y: 0.2993},
+		{name: "hex map", in: map[string]interface{}{"hex": "#ff0000"}, x: 0.7006, y: 0.2993},
+		{name: "rgb list", in: []interface{}{255.0, 0.0, 0.0}, x: 0.7006, y: 0.2993},
+		{name: "rgb map", in: map[string]interface{}{"r": 255.0, "g": 0.0, "b": 0.0}, x: 0.7006, y: 0.2993},
+		{name: "bad hex", in: "#ff00", wantErr: true},
+		{name: "too many values", in: []interface{}{1.0, 2.0, 3.0, 4.0}, wantErr: true},
+		{name: "not a number", in: []interface{}{"a", 1.0}, wantErr: true},
+		{name: "x without y", in: map[string]interface{}{"x": 0.5}, wantErr: true},
+		{name: "incomplete rgb map", in: map[string]interface{}{"r": 1.0, "g": 2.0}, wantErr: true},
+		{name: "unsupported type", in: 42.0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y, err := parseColor(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseColor(%v) = %v, %v, want an error", tt.in, x, y)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(float64(x-tt.x)) > 0.01 || math.Abs(float64(y-tt.y)) > 0.01 {
+				t.Fatalf("parseColor(%v) = %v, %v, want %v, %v", tt.in, x, y, tt.x, tt.y)
+			}
+		})
+	}
+}
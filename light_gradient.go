@@ -0,0 +1,246 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+var HueGradient = family.WithModel("hue-gradient")
+
+func init() {
+	resource.RegisterComponent(sensor.API, HueGradient,
+		resource.Registration[sensor.Sensor, *GradientConfig]{
+			Constructor: newHueGradient,
+		},
+	)
+}
+
+type GradientConfig struct {
+	BridgeHost string `json:"bridge_host,omitempty"`
+	Username   string `json:"username"`
+	LightID    int    `json:"light_id"`
+}
+
+func (cfg *GradientConfig) Validate(path string) ([]string, []string, error) {
+	if cfg.Username == "" {
+		return nil, nil, fmt.Errorf("need a username (API key) for the Hue bridge")
+	}
+	if cfg.LightID == 0 {
+		return nil, nil, fmt.Errorf("need a light_id")
+	}
+	return nil, nil, nil
+}
+
+// namedGradients are the presets accepted by set_gradient in place of a color list.
+var namedGradients = map[string][]string{
+	"sunset":  {"#ff4e00", "#ff8c00", "#ff2a6d", "#7b2cbf", "#240046"},
+	"ocean":   {"#03045e", "#0077b6", "#00b4d8", "#48cae4", "#90e0ef"},
+	"forest":  {"#0b3d0b", "#1b5e20", "#388e3c", "#8bc34a", "#cddc39"},
+	"fire":    {"#ff0000", "#ff4500", "#ff8c00", "#ffa500", "#ffd700"},
+	"rainbow": {"#ff0000", "#ffff00", "#00ff00", "#00ffff", "#0000ff"},
+	"aurora":  {"#00ff87", "#00c9a7", "#3d5afe", "#7c4dff", "#d500f9"},
+}
+
+// defaultGradientPoints is used when the bridge does not report points_capable.
+const defaultGradientPoints = 5
+
+type hueGradient struct {
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+
+	name   resource.Name
+	logger logging.Logger
+	cfg    *GradientConfig
+
+	v2     *clipV2Client
+	v2ID   string // v2 light resource id matching cfg.LightID
+	points int    // maximum number of gradient points the light accepts
+}
+
+func newHueGradient(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	conf, err := resource.NativeConfig[*GradientConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &hueGradient{
+		name:   rawConf.ResourceName(),
+		logger: logger,
+		cfg:    conf,
+	}
+
+	bridge, _, err := connectToLight(conf.BridgeHost, conf.Username, conf.LightID, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s.v2 = newClipV2Client(bridge.Host, conf.Username)
+	light, err := s.v2.findLightByV1ID(ctx, conf.LightID)
+	if err != nil {
+		return nil, err
+	}
+	if light.Gradient == nil {
+		return nil, fmt.Errorf("light %d (%s) does not support gradients", conf.LightID, light.Metadata.Name)
+	}
+
+	s.v2ID = light.ID
+	s.points = light.Gradient.PointsCapable
+	if s.points == 0 {
+		s.points = defaultGradientPoints
+	}
+
+	return s, nil
+}
+
+func (s *hueGradient) Name() resource.Name {
+	return s.name
+}
+
+// DoCommand supports:
+//
+//	{"set_gradient": "sunset"}
+//	{"set_gradient": ["#ff0000", [0, 0, 255], {"x": 0.3, "y": 0.3}]}
+//	{"set_gradient": {"colors": [...], "mode": "interpolated_palette"}}
+//	{"set_gradient": {"name": "ocean"}}
+//	{"get_gradient": true}
+//	{"list_gradients": true}
+func (s *hueGradient) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if v, ok := cmd["set_gradient"]; ok {
+		if err := s.setGradient(ctx, v); err != nil {
+			return nil, err
+		}
+		return s.Readings(ctx, nil)
+	}
+	if _, ok := cmd["get_gradient"]; ok {
+		return s.Readings(ctx, nil)
+	}
+	if _, ok := cmd["list_gradients"]; ok {
+		names := make([]string, 0, len(namedGradients))
+		for k := range namedGradients {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		out := make([]interface{}, len(names))
+		for i, n := range names {
+			out[i] = n
+		}
+		return map[string]interface{}{"gradients": out}, nil
+	}
+	return nil, fmt.Errorf("unknown command, expected one of set_gradient, get_gradient, list_gradients")
+}
+
+// setGradient parses a set_gradient argument and writes the resulting points.
+func (s *hueGradient) setGradient(ctx context.Context, v interface{}) error {
+	var colors []interface{}
+	mode := ""
+
+	switch arg := v.(type) {
+	case string:
+		named, err := namedGradientColors(arg)
+		if err != nil {
+			return err
+		}
+		colors = named
+	case []interface{}:
+		colors = arg
+	case map[string]interface{}:
+		if m, ok := arg["mode"].(string); ok {
+			mode = m
+		}
+		if name, ok := arg["name"].(string); ok {
+			named, err := namedGradientColors(name)
+			if err != nil {
+				return err
+			}
+			colors = named
+		} else if list, ok := arg["colors"].([]interface{}); ok {
+			colors = list
+		} else {
+			return fmt.Errorf("set_gradient needs \"name\" or \"colors\"")
+		}
+	default:
+		return fmt.Errorf("set_gradient expects a gradient name, a list of colors, or a map")
+	}
+
+	if len(colors) < 2 {
+		return fmt.Errorf("a gradient needs at least 2 colors, got %d", len(colors))
+	}
+	if len(colors) > s.points {
+		return fmt.Errorf("light %d supports at most %d gradient points, got %d", s.cfg.LightID, s.points, len(colors))
+	}
+
+	points := make([]clipV2GradientPoint, len(colors))
+	for i, c := range colors {
+		x, y, err := parseColor(c)
+		if err != nil {
+			return fmt.Errorf("gradient color %d: %w", i, err)
+		}
+		points[i] = clipV2GradientPoint{Color: clipV2Color{XY: clipV2XY{X: float64(x), Y: float64(y)}}}
+	}
+
+	gradient := map[string]interface{}{"points": points}
+	if mode != "" {
+		gradient["mode"] = mode
+	}
+	return s.v2.updateLight(ctx, s.v2ID, map[string]interface{}{
+		"on":       map[string]interface{}{"on": true},
+		"gradient": gradient,
+	})
+}
+
+func namedGradientColors(name string) ([]interface{}, error) {
+	hexes, ok := namedGradients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown gradient %q", name)
+	}
+	colors := make([]interface{}, len(hexes))
+	for i, h := range hexes {
+		colors[i] = h
+	}
+	return colors, nil
+}
+
+// Readings returns the light's gradient capabilities and the color of each segment.
+func (s *hueGradient) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	light, err := s.v2.getLight(ctx, s.v2ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gradient state: %w", err)
+	}
+	if light.Gradient == nil {
+		return nil, fmt.Errorf("light %d no longer reports a gradient", s.cfg.LightID)
+	}
+
+	segments := make([]interface{}, len(light.Gradient.Points))
+	for i, p := range light.Gradient.Points {
+		x, y := float32(p.Color.XY.X), float32(p.Color.XY.Y)
+		r, g, b := xyBriToRGB([]float32{x, y}, 255)
+		segments[i] = map[string]interface{}{
+			"cie_x": p.Color.XY.X,
+			"cie_y": p.Color.XY.Y,
+			"red":   int(r),
+			"green": int(g),
+			"blue":  int(b),
+			"hex":   rgbToHex(r, g, b),
+		}
+	}
+
+	modes := make([]interface{}, len(light.Gradient.ModeValues))
+	for i, m := range light.Gradient.ModeValues {
+		modes[i] = m
+	}
+
+	return map[string]interface{}{
+		"light_name":     light.Metadata.Name,
+		"gradient_mode":  light.Gradient.Mode,
+		"gradient_modes": modes,
+		"points_capable": light.Gradient.PointsCapable,
+		"pixel_count":    light.Gradient.PixelCount,
+		"segment_count":  len(segments),
+		"segments":       segments,
+	}, nil
+}
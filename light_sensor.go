@@ -72,6 +72,9 @@ func (s *hueLightSensor) Name() resource.Name {
 }
 
 func (s *hueLightSensor) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if v, ok := cmd["identify"]; ok {
+		return identifyLight(ctx, s.bridge, s.cfg.LightID, v)
+	}
 	return map[string]interface{}{}, nil
 }
 
@@ -92,7 +95,7 @@ func (s *hueLightSensor) Readings(ctx context.Context, extra map[string]interfac
 	r, g, b := xyBriToRGB(light.State.Xy, light.State.Bri)
 	brightness := int(light.State.Bri) * 100 / 254
 
-	return map[string]interface{}{
+	readings := map[string]interface{}{
 		// Light metadata
 		"light_name":   light.Name,
 		"light_type":   light.Type,
@@ -120,5 +123,12 @@ func (s *hueLightSensor) Readings(ctx context.Context, extra map[string]interfac
 		"red":        int(r),
 		"green":      int(g),
 		"blue":       int(b),
-	}, nil
+	}
+
+	// The component that currently holds the light, if any.
+	if owner := lightOwner(s.bridge, s.cfg.LightID); len(owner) > 0 {
+		readings["owner"] = owner["owner"]
+		readings["owner_priority"] = owner["priority"]
+	}
+	return readings, nil
 }
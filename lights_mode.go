@@ -2,9 +2,13 @@ package hue
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/amimof/huego"
 	toggleswitch "go.viam.com/rdk/components/switch"
@@ -28,31 +32,141 @@ type LightModeConfig struct {
 	Dance      map[string][]int `json:"dance,omitempty"` // group name -> light IDs, lights in a group stay in sync
 	Daylight   []int            `json:"daylight,omitempty"`
 	Warm       []int            `json:"warm,omitempty"`
+
+	// DanceStyle customizes the dance mode's colors, speed and group phases.
+	DanceStyle *DanceStyle `json:"dance_style,omitempty"`
+
+	// Modes replaces the fixed dance/daylight/warm modes with an ordered list
+	// of user-defined modes. Position 0 is always "none".
+	Modes []ModeConfig `json:"modes,omitempty"`
+
+	// TransitionMs is the default fade when activating a mode or restoring
+	// lights; a mode state's own transition_ms and extra["transition_ms"] on
+	// SetPosition take precedence. Unset uses the bridge default of 400 ms.
+	TransitionMs *int `json:"transition_ms,omitempty"`
+
+	// RestoreOnClose puts the baseline back when the component is removed or
+	// the module stops, instead of leaving the lights in the active mode.
+	RestoreOnClose bool `json:"restore_on_close,omitempty"`
+
+	// DriftCheck is what to do when a state or dance mode's lights are changed
+	// from elsewhere: "flag" (default), "none", "reapply" or "off".
+	// DriftPollS also checks in the background; otherwise only GetPosition and
+	// mode_status check.
+	DriftCheck string  `json:"drift_check,omitempty"`
+	DriftPollS float64 `json:"drift_poll_s,omitempty"`
+
+	// GroupActions applies a state shared by several lights through one bridge
+	// group action so they change in sync. Defaults to true.
+	GroupActions *bool `json:"group_actions,omitempty"`
+
+	// BestEffort leaves the lights that did change in the new mode when some
+	// fail, instead of rolling them all back.
+	BestEffort bool `json:"best_effort,omitempty"`
+
+	// Reconcile puts lights back into the active state or dance mode when they
+	// come back from a power cut or are changed elsewhere.
+	Reconcile *ReconcileConfig `json:"reconcile,omitempty"`
+
+	// Limits bound every light the component sets, in any mode; a mode's own
+	// limits add to them while it is active.
+	Limits *LightLimits `json:"limits,omitempty"`
+
+	// Arbitration sets how the component competes with others writing the
+	// same lights. By default a mode holds its lights until the next switch.
+	Arbitration *ArbitrationConfig `json:"arbitration,omitempty"`
 }
 
+// restoreTimeout bounds restores and cleanup that happen in the background or
+// on close, so an unreachable bridge cannot hold up shutdown.
+const restoreTimeout = 5 * time.Second
+
 func (cfg *LightModeConfig) Validate(path string) ([]string, []string, error) {
 	if cfg.Username == "" {
 		return nil, nil, fmt.Errorf("need a username (API key) for the Hue bridge")
 	}
+	if len(cfg.Modes) > 0 && (len(cfg.Dance) > 0 || len(cfg.Daylight) > 0 || len(cfg.Warm) > 0 || cfg.DanceStyle != nil) {
+		return nil, nil, fmt.Errorf("use either modes or the dance/daylight/warm keys, not both")
+	}
+	if cfg.DanceStyle != nil {
+		if err := cfg.DanceStyle.validate(cfg.Dance); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.TransitionMs != nil {
+		if err := validateTransitionMs(*cfg.TransitionMs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := validateDriftCheck(cfg.DriftCheck); err != nil {
+		return nil, nil, err
+	}
+	if cfg.DriftPollS < 0 {
+		return nil, nil, fmt.Errorf("drift_poll_s must be positive, got %v", cfg.DriftPollS)
+	}
+	if cfg.Reconcile != nil {
+		if err := cfg.Reconcile.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Limits != nil {
+		if err := cfg.Limits.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Arbitration != nil {
+		if err := cfg.Arbitration.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Modes {
+		if err := cfg.Modes[i].validate(); err != nil {
+			return nil, nil, err
+		}
+		if seen[cfg.Modes[i].Name] {
+			return nil, nil, fmt.Errorf("duplicate mode name %q", cfg.Modes[i].Name)
+		}
+		seen[cfg.Modes[i].Name] = true
+	}
 	return nil, nil, nil
 }
 
-// positions maps switch position to mode name
-var modeNames = []string{"none", "dance", "daylight", "warm"}
-
 type hueLightMode struct {
 	resource.AlwaysRebuild
-	resource.TriviallyCloseable
 
 	name   resource.Name
 	logger logging.Logger
 	cfg    *LightModeConfig
 
 	bridge *huego.Bridge
+	claim  *claimant // owner of every light the component writes
+
+	modes         []*lightMode // modes[i] is position i+1
+	positionNames []string     // "none" followed by each mode name
 
 	mu          sync.Mutex
 	position    uint32
-	savedStates map[int]*huego.State // light ID -> saved state before mode was activated
+	savedStates map[int]*huego.State // baseline: light ID -> state from before any mode touched it
+
+	jobs   jobRunner   // background effect or routine, at most one at a time
+	groups *groupCache // bridge groups used for group actions
+
+	activeLights   []int     // lights the active mode was applied to
+	settleAt       time.Time // drift checks wait until the mode's fade is done
+	drifted        []int     // result of the last drift check
+	reapplyPending bool      // drifted lights are about to be re-applied
+	driftCheckedAt time.Time
+	lastErrors     lightErrors // lights that failed in the last activation or restore
+	rolledBack     bool        // the last activation failed and was undone
+	reconcile      *reconciler // nil unless configured
+
+	caps     map[int]lightCaps // light ID -> capabilities, read once from the bridge
+	degraded map[int]string    // light ID -> how the active mode was adapted to it
+
+	pollCancel context.CancelFunc
+	pollDone   chan struct{}
+	reapplying sync.WaitGroup // drift re-applies running in the background
 }
 
 func newHueLightMode(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
@@ -77,9 +191,29 @@ func newHueLightMode(ctx context.Context, deps resource.Dependencies, rawConf re
 		logger:      logger,
 		cfg:         conf,
 		bridge:      huego.New(bridgeHost, conf.Username),
+		modes:       buildModes(conf),
 		savedStates: make(map[int]*huego.State),
+		caps:        make(map[int]lightCaps),
+	}
+	s.groups = newGroupCache(s.bridge, s.name.String())
+	s.positionNames = []string{"none"}
+	for _, m := range s.modes {
+		s.positionNames = append(s.positionNames, m.name)
 	}
 
+	if conf.DriftCheck != driftOff && conf.DriftPollS > 0 {
+		var pollCtx context.Context
+		pollCtx, s.pollCancel = context.WithCancel(context.Background())
+		s.pollDone = make(chan struct{})
+		go func() {
+			defer close(s.pollDone)
+			s.pollDrift(pollCtx, time.Duration(conf.DriftPollS*float64(time.Second)))
+		}()
+	}
+	s.claim = newClaimant(s.name.String(), conf.Arbitration, priorityMode, 0, logger)
+	s.jobs.claim = s.claim
+	s.reconcile = newReconciler(conf.Reconcile, s.bridge, s.claim, logger, s.reconcileLights)
+
 	return s, nil
 }
 
@@ -87,65 +221,418 @@ func (s *hueLightMode) Name() resource.Name {
 	return s.name
 }
 
+// DoCommand supports:
+//
+//	{"start_effect": {"type": "candle", "lights": [1, 2], ...EffectConfig}}
+//	{"stop_effect": true}
+//	{"effect_status": true}
+//	{"start_routine": {"type": "sunrise", "lights": [1, 2], ...RoutineConfig}}
+//	{"stop_routine": true}
+//	{"routine_status": true}
+//	{"circadian_status": true}
+//	{"resume_circadian": true}  or  {"resume_circadian": [1, 2]}
+//	{"get_baseline": true}
+//	{"clear_baseline": true}
+//	{"mode_status": true}
+//
+// An effect started this way snapshots its lights first and restores them
+// when it is stopped or its duration runs out; a stopped routine leaves the
+// lights where the ramp had reached. Only one effect or routine runs at a
+// time, and changing the switch position stops it.
 func (s *hueLightMode) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if hasStep(cmd) {
+		return s.stepLights(ctx, cmd)
+	}
+	if v, ok := cmd["start_effect"]; ok {
+		var cfg EffectConfig
+		if err := decodeArg(v, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid start_effect: %w", err)
+		}
+		e, err := newEffect(&cfg, cfg.Lights)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if ok, err := s.claim.acquire(s.bridge, cfg.Lights, func(ctx context.Context) error {
+			_, err := s.DoCommand(ctx, cmd)
+			return err
+		}); !ok {
+			return deferredResult(err)
+		}
+		s.jobs.stop()
+		registerLimits(s.bridge, s.name.String(), cfg.Lights, s.cfg.Limits, s.logger)
+		saved, err := s.snapshotLights(cfg.Lights)
+		if err != nil {
+			return nil, err
+		}
+		s.jobs.start(s.bridge, e, s.logger, func() {
+			ctx, cancel := context.WithTimeout(withClaimant(context.Background(), s.claim), restoreTimeout)
+			defer cancel()
+			fade, _ := transitionArg(nil, s.cfg.TransitionMs)
+			if err := s.restoreLights(ctx, saved, fade); err != nil {
+				s.logger.Warnf("failed to restore lights after %s effect: %v", e.kind, err)
+			}
+			go s.releaseIdle()
+		})
+		return s.jobs.jobStatus("effect"), nil
+	}
+	if _, ok := cmd["stop_effect"]; ok {
+		j := s.jobs.stopCategory("effect")
+		s.releaseIdle()
+		return stoppedJob(j), nil
+	}
+	if _, ok := cmd["effect_status"]; ok {
+		return s.jobs.jobStatus("effect"), nil
+	}
+
+	if v, ok := cmd["start_routine"]; ok {
+		var cfg RoutineConfig
+		if err := decodeArg(v, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid start_routine: %w", err)
+		}
+		r, err := newRoutine(&cfg, cfg.Lights)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if ok, err := s.claim.acquire(s.bridge, cfg.Lights, func(ctx context.Context) error {
+			_, err := s.DoCommand(ctx, cmd)
+			return err
+		}); !ok {
+			return deferredResult(err)
+		}
+		s.jobs.start(s.bridge, r, s.logger, func() { go s.releaseIdle() })
+		return s.jobs.jobStatus("routine"), nil
+	}
+	if _, ok := cmd["stop_routine"]; ok {
+		j := s.jobs.stopCategory("routine")
+		s.releaseIdle()
+		return stoppedJob(j), nil
+	}
+	if _, ok := cmd["routine_status"]; ok {
+		return s.jobs.jobStatus("routine"), nil
+	}
+
+	if _, ok := cmd["mode_status"]; ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.checkDrift(withClaimant(ctx, s.claim)); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"position":         int(s.position),
+			"mode":             s.positionNames[s.position],
+			"drifted":          len(s.drifted) > 0,
+			"drifted_lights":   intsToInterfaces(s.drifted),
+			"failed_lights":    s.lastErrors.toMap(),
+			"rolled_back":      s.rolledBack,
+			"degraded_lights":  degradedToMap(s.degraded),
+			"limit_violations": limitViolations(s.bridge, s.activeLights),
+			"owners":           lightOwners(s.bridge, s.activeLights),
+		}, nil
+	}
+
+	if _, ok := cmd["get_baseline"]; ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		lights := make(map[string]interface{}, len(s.savedStates))
+		for id, st := range s.savedStates {
+			lights[strconv.Itoa(id)] = stateToMap(st)
+		}
+		return map[string]interface{}{"lights": lights}, nil
+	}
+	if _, ok := cmd["clear_baseline"]; ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := len(s.savedStates)
+		s.savedStates = make(map[int]*huego.State)
+		return map[string]interface{}{"cleared": n}, nil
+	}
+
+	if _, ok := cmd["circadian_status"]; ok {
+		return s.jobs.jobStatus("circadian"), nil
+	}
+	if v, ok := cmd["resume_circadian"]; ok {
+		var ids []int
+		if _, all := v.(bool); !all {
+			if err := decodeArg(v, &ids); err != nil {
+				return nil, fmt.Errorf("resume_circadian expects true or a list of light IDs: %w", err)
+			}
+		}
+		c, ok := s.jobs.running().(*circadian)
+		if !ok {
+			return nil, fmt.Errorf("no circadian mode is active")
+		}
+		return map[string]interface{}{"resumed": intsToInterfaces(c.resume(ids))}, nil
+	}
 	return nil, nil
 }
 
+func stoppedJob(j job) map[string]interface{} {
+	if j == nil {
+		return map[string]interface{}{"stopped": ""}
+	}
+	return map[string]interface{}{"stopped": j.name()}
+}
+
+// Close stops any running effect or routine so its goroutine does not outlive
+// the component, restores the baseline if restore_on_close is set, and deletes
+// the bridge groups the component created.
+func (s *hueLightMode) Close(ctx context.Context) error {
+	if s.pollCancel != nil {
+		s.pollCancel()
+		<-s.pollDone
+	}
+	s.reapplying.Wait()
+	s.reconcile.close()
+	s.jobs.stop()
+	defer s.claim.close(s.bridge)
+	defer unregisterLimits(s.bridge, s.modeLimitsOwner())
+	defer unregisterLimits(s.bridge, s.name.String())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, restoreTimeout)
+	defer cancel()
+
+	var err error
+	if s.cfg.RestoreOnClose && len(s.savedStates) > 0 {
+		fade, _ := transitionArg(nil, s.cfg.TransitionMs)
+		if rerr := s.restoreState(ctx, fade); rerr != nil {
+			err = fmt.Errorf("failed to restore lights on close: %w", rerr)
+		}
+	}
+	if gerr := s.groups.cleanup(ctx); gerr != nil && err == nil {
+		err = gerr
+	}
+	return err
+}
+
 // SetPosition switches between modes.
-// Position 0 = "none" (restore saved state), Position 1 = "dance" (colorloop).
+// Position 0 = "none" (restore saved state), positions 1+ are the configured
+// modes in order (dance, daylight, warm when no modes list is configured).
+// extra["transition_ms"] sets the fade for activation or restore; effects,
+// routines and circadian modes keep their own timing.
 func (s *hueLightMode) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
-	if int(position) >= len(modeNames) {
-		return fmt.Errorf("invalid position %d, must be 0-%d", position, len(modeNames)-1)
+	if int(position) >= len(s.positionNames) {
+		return fmt.Errorf("invalid position %d, must be 0-%d", position, len(s.positionNames)-1)
+	}
+	fade, err := transitionArg(extra, s.cfg.TransitionMs)
+	if err != nil {
+		return err
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// A switch blocked by a higher-priority owner leaves the active mode
+	// running.
+	var mode *lightMode
+	var lightIDs []int
+	if position > 0 {
+		mode = s.modes[position-1]
+		if lightIDs, err = mode.resolveLights(ctx, s.bridge); err != nil {
+			return err
+		}
+		if ok, err := s.claim.acquire(s.bridge, lightIDs, func(ctx context.Context) error {
+			return s.SetPosition(ctx, position, extra)
+		}); !ok {
+			return err
+		}
+	}
+	ctx = withClaimant(ctx, s.claim)
+
+	// Any running effect or routine, whether from a mode or DoCommand, ends
+	// when the position changes.
+	s.jobs.stop()
+	s.reconcile.clear()
+	s.rolledBack = false
+
 	if position == 0 {
-		return s.restoreState()
+		unregisterLimits(s.bridge, s.modeLimitsOwner())
+		defer s.claim.keep(s.bridge, nil)
+		return s.restoreState(ctx, fade)
+	}
+	// Lights of the previous mode, or of an effect or routine, that this
+	// mode leaves out are free for other components again.
+	defer func() { s.claim.keep(s.bridge, s.activeLights) }()
+
+	// The baseline is captured fresh only when leaving "none"; switching
+	// between modes keeps it so "none" restores the original lighting.
+	if s.position == 0 {
+		s.savedStates = make(map[int]*huego.State)
 	}
 
-	lightIDs := s.lightIDsForPosition(position)
-	if err := s.saveState(lightIDs); err != nil {
+	registerLimits(s.bridge, s.name.String(), lightIDs, s.cfg.Limits, s.logger)
+	unregisterLimits(s.bridge, s.modeLimitsOwner())
+	registerLimits(s.bridge, s.modeLimitsOwner(), lightIDs, mode.limits, s.logger)
+
+	// Lights already in the baseline keep their first snapshot; the others no
+	// earlier mode touched, so they are still in their original state. The
+	// same snapshot is used to roll back a failed activation.
+	before, err := s.snapshotLights(lightIDs)
+	if err != nil {
 		return err
 	}
+	var added []int
+	for id, st := range before {
+		if _, ok := s.savedStates[id]; !ok {
+			s.savedStates[id] = st
+			added = append(added, id)
+		}
+	}
+	prevLights := s.activeLights
+	s.activeLights = lightIDs
+	s.degraded = nil
+	s.resetDrift()
 
-	switch modeNames[position] {
-	case "dance":
-		return s.activateDance(s.cfg.Dance, position)
-	case "daylight":
-		return s.activateDaylight(lightIDs, position)
-	case "warm":
-		return s.activateWarm(lightIDs, position)
+	err = s.activate(ctx, mode, lightIDs, position, fade, extra)
+	var failed lightErrors
+	if err == nil || s.cfg.BestEffort || !errors.As(err, &failed) {
+		return err
 	}
 
-	return fmt.Errorf("unknown mode %q", modeNames[position])
+	for _, id := range added {
+		delete(s.savedStates, id)
+	}
+	s.activeLights = prevLights
+	return s.rollback(ctx, mode.name, before, fade, failed)
 }
 
-func (s *hueLightMode) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+// releaseIdle gives up the lights that neither the active mode nor a running
+// effect or routine uses, e.g. those of an effect that just ended. It takes
+// s.mu, so a job ending while a caller holds s.mu to stop it must run it in
+// its own goroutine.
+func (s *hueLightMode) releaseIdle() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.position, nil
+	s.claim.keep(s.bridge, s.heldLights())
 }
 
-func (s *hueLightMode) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
-	return uint32(len(modeNames)), modeNames, nil
+// heldLights returns the lights of the active mode and of the running effect
+// or routine, if any. s.mu must be held.
+func (s *hueLightMode) heldLights() []int {
+	ids := append([]int(nil), s.activeLights...)
+	if j := s.jobs.running(); j != nil {
+		ids = append(ids, j.lightIDs()...)
+	}
+	return ids
+}
+
+// modeLimitsOwner names the active mode's limits, kept apart from the
+// component's own.
+func (s *hueLightMode) modeLimitsOwner() string {
+	return s.name.String() + "/mode"
+}
+
+// reconcileLights puts lights the reconciler found out of step back into the
+// active mode. Modes run by a job keep updating their lights on their own.
+func (s *hueLightMode) reconcileLights(ctx context.Context, ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reapplyLights(ctx, s.position, ids)
+}
+
+// reapplyLights puts the given lights back into the mode at position, unless
+// the switch has moved on since. s.mu must be held.
+func (s *hueLightMode) reapplyLights(ctx context.Context, position uint32, ids []int) error {
+	if position == 0 || s.position != position {
+		return nil
+	}
+	mode := s.modes[s.position-1]
+	fade, _ := transitionArg(nil, s.cfg.TransitionMs)
+	switch mode.kind {
+	case modeKindDance:
+		return s.reconcileDance(ctx, mode.dance, ids, fade)
+	case modeKindState:
+		return s.activateState(ctx, mode, ids, s.position, nil)
+	}
+	return nil
 }
 
-// lightIDsForPosition returns a flat list of all light IDs for a given mode position.
-// For dance mode the groups are flattened so saveState can snapshot every light.
-func (s *hueLightMode) lightIDsForPosition(position uint32) []int {
-	switch modeNames[position] {
-	case "dance":
-		return flattenDanceGroups(s.cfg.Dance)
-	case "daylight":
-		return s.cfg.Daylight
-	case "warm":
-		return s.cfg.Warm
+// reconcileDance seeds and restarts the colorloop on the given dance lights
+// only, from the same starting hue as when the dance began. Lights without
+// color are just turned back on; a running brightness pulse keeps updating
+// the dimmable ones. s.mu must be held.
+func (s *hueLightMode) reconcileDance(ctx context.Context, groups map[string][]int, ids []int, fade int) error {
+	caps := s.capsFor(ctx, flattenDanceGroups(groups))
+	color := make(map[string][]int, len(groups))
+	for k, group := range groups {
+		for _, id := range group {
+			if caps[id].color {
+				color[k] = append(color[k], id)
+			}
+		}
+	}
+	startHues, _ := danceStartHues(color)
+
+	var loop, onOnly []int
+	for _, id := range ids {
+		if _, ok := startHues[id]; ok {
+			loop = append(loop, id)
+		} else {
+			onOnly = append(onOnly, id)
+		}
+	}
+	errs := s.danceByLights(ctx, startHues, loop, fade)
+	for id, err := range forEachLight(ctx, onOnly, func(ctx context.Context, id int) error {
+		return setLightState(ctx, s.bridge, id, huego.State{On: true}, transitionDefault)
+	}) {
+		if errs == nil {
+			errs = lightErrors{}
+		}
+		errs[id] = err
+	}
+	if errs != nil {
+		return fmt.Errorf("failed to re-apply dance mode: %w", errs)
 	}
 	return nil
 }
 
+// activate puts lightIDs into a mode and moves to its position on success.
+// s.mu must be held.
+func (s *hueLightMode) activate(ctx context.Context, mode *lightMode, lightIDs []int, position uint32, fade int, extra map[string]interface{}) error {
+	switch mode.kind {
+	case modeKindDance:
+		if mode.danceStyle.driven() {
+			return s.activateDrivenDance(ctx, mode, position)
+		}
+		return s.activateDance(ctx, mode.dance, position, fade)
+	case modeKindState:
+		return s.activateState(ctx, mode, lightIDs, position, extra)
+	case modeKindEffect:
+		return s.activateEffect(mode, lightIDs, position)
+	case modeKindRoutine:
+		return s.activateRoutine(mode, lightIDs, position)
+	case modeKindCircadian:
+		return s.activateCircadian(mode, lightIDs, position)
+	}
+
+	return fmt.Errorf("unknown mode type %q", mode.kind)
+}
+
+// GetPosition returns the active mode, after checking that its lights still
+// match it (see drift_check).
+func (s *hueLightMode) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkDrift(withClaimant(ctx, s.claim)); err != nil {
+		// a bridge hiccup should not make the switch unreadable
+		s.logger.Debugf("drift check failed: %v", err)
+	}
+	return s.position, nil
+}
+
+func (s *hueLightMode) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	return uint32(len(s.positionNames)), s.positionNames, nil
+}
+
 // flattenDanceGroups collapses all groups in the dance map into a single slice of IDs.
 func flattenDanceGroups(groups map[string][]int) []int {
 	var ids []int
@@ -166,18 +653,67 @@ func sortedKeys(m map[string][]int) []string {
 	return keys
 }
 
-// saveState snapshots the current state of each light before activating a mode.
-func (s *hueLightMode) saveState(lightIDs []int) error {
-	s.savedStates = make(map[int]*huego.State)
+// stateToMap describes a saved light state for DoCommand results, with the
+// color fields that match its color mode.
+func stateToMap(st *huego.State) map[string]interface{} {
+	out := map[string]interface{}{
+		"on":        st.On,
+		"bri":       int(st.Bri),
+		"colormode": st.ColorMode,
+	}
+	switch st.ColorMode {
+	case "ct":
+		out["ct"] = int(st.Ct)
+	case "xy":
+		if len(st.Xy) == 2 {
+			out["xy"] = []interface{}{float64(st.Xy[0]), float64(st.Xy[1])}
+		}
+	case "hs":
+		out["hue"] = int(st.Hue)
+		out["sat"] = int(st.Sat)
+	}
+	return out
+}
+
+// snapshotLights reads the current state of each light with a single bridge
+// request.
+func (s *hueLightMode) snapshotLights(lightIDs []int) (map[int]*huego.State, error) {
+	if len(lightIDs) == 0 {
+		return map[int]*huego.State{}, nil
+	}
+	lights, err := s.bridge.GetLights()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get light states: %w", err)
+	}
+	byID := make(map[int]*huego.State, len(lights))
+	for i := range lights {
+		byID[lights[i].ID] = lights[i].State
+	}
+
+	saved := make(map[int]*huego.State, len(lightIDs))
 	for _, id := range lightIDs {
-		light, err := s.bridge.GetLight(id)
-		if err != nil {
-			return fmt.Errorf("failed to get state for light %d: %w", id, err)
+		st, ok := byID[id]
+		if !ok || st == nil {
+			return nil, fmt.Errorf("light %d not found on the bridge", id)
 		}
-		saved := *light.State
-		s.savedStates[id] = &saved
+		state := *st
+		saved[id] = &state
 	}
-	return nil
+	return saved, nil
+}
+
+// rollback puts the lights of a partly failed activation back the way they
+// were before it, so a mode applies to all of its lights or none. The position
+// is left unchanged. s.mu must be held.
+func (s *hueLightMode) rollback(ctx context.Context, modeName string, before map[int]*huego.State, fade int, failed lightErrors) error {
+	s.jobs.stop() // e.g. a brightness pulse started for part of a dance
+	s.logger.Infof("mode %q failed on lights %v, rolling back", modeName, failed.ids())
+	rollbackErrs := s.restoreLights(ctx, before, fade)
+	s.lastErrors = failed
+	s.rolledBack = true
+	s.degraded = nil
+	s.resetDrift()
+	return &activationError{mode: modeName, failed: failed, rollbackFailed: rollbackErrs}
 }
 
 // restoreState restores each saved light back to its pre-mode state.
@@ -185,28 +721,36 @@ func (s *hueLightMode) saveState(lightIDs []int) error {
 // apply the saved color fields. This is necessary because the Hue bridge
 // processes JSON fields in order, and sending color fields while an effect is
 // still active causes the bridge to ignore those fields.
-func (s *hueLightMode) restoreState() error {
-	var firstErr error
-	for id, state := range s.savedStates {
-		light, err := s.bridge.GetLight(id)
-		if err != nil {
-			s.logger.Warnf("failed to get light %d for restore: %v", id, err)
-			if firstErr == nil {
-				firstErr = err
-			}
-			continue
-		}
+func (s *hueLightMode) restoreState(ctx context.Context, fade int) error {
+	var err error
+	errs := s.restoreLights(ctx, s.savedStates, fade)
+	if errs != nil {
+		err = fmt.Errorf("failed to restore lights: %w", errs)
+	}
+	s.lastErrors = errs
+	s.savedStates = make(map[int]*huego.State)
+	s.position = 0
+	s.activeLights = nil
+	s.degraded = nil
+	s.resetDrift()
+	return err
+}
 
+// restoreLights puts each light back into its snapshotted state, several
+// lights at a time, continuing past failures and returning them by light.
+func (s *hueLightMode) restoreLights(ctx context.Context, states map[int]*huego.State, fade int) lightErrors {
+	ids := make([]int, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	return forEachLight(ctx, ids, func(ctx context.Context, id int) error {
+		state := states[id]
 		// Step 1: stop the colorloop effect before changing color fields.
 		// Use On:true here regardless of the saved state — the bridge rejects
 		// effect changes on lights that are off. Step 2 will restore the real
 		// on/off state along with the color fields.
-		if err := light.SetState(huego.State{On: true, Effect: "none"}); err != nil {
-			s.logger.Warnf("failed to stop effect on light %d for restore: %v", id, err)
-			if firstErr == nil {
-				firstErr = err
-			}
-			continue
+		if err := setLightState(ctx, s.bridge, id, huego.State{On: true, Effect: "none"}, fade); err != nil {
+			return fmt.Errorf("failed to stop effect: %w", err)
 		}
 
 		// Step 2: restore brightness and the color fields matching the original
@@ -239,16 +783,8 @@ func (s *hueLightMode) restoreState() error {
 				restore.Sat = 1
 			}
 		}
-		if err := light.SetState(restore); err != nil {
-			s.logger.Warnf("failed to restore state for light %d: %v", id, err)
-			if firstErr == nil {
-				firstErr = err
-			}
-		}
-	}
-	s.savedStates = make(map[int]*huego.State)
-	s.position = 0
-	return firstErr
+		return setLightState(ctx, s.bridge, id, restore, fade)
+	})
 }
 
 // activateDance enables the colorloop effect on each light, staggered by group.
@@ -262,9 +798,47 @@ func (s *hueLightMode) restoreState() error {
 // bridge may start the colorloop before honoring the hue seed, causing all
 // groups to begin at the same position. The hue field has omitempty, so a
 // startHue of 0 is bumped to 1 to prevent the field from being omitted.
-func (s *hueLightMode) activateDance(groups map[string][]int, position uint32) error {
+//
+// Lights without color cannot colorloop: dimmable ones pulse their brightness
+// instead and on/off ones are just turned on.
+func (s *hueLightMode) activateDance(ctx context.Context, groups map[string][]int, position uint32, fade int) error {
+	groups, pulse, onOnly := s.splitDanceLights(ctx, groups)
+	fallbackErrs := s.startDanceFallbacks(ctx, pulse, onOnly)
+
+	startHues, ids := danceStartHues(groups)
+
+	var errs lightErrors
+	if !s.danceByGroups(ctx, groups, startHues, ids, fade) {
+		errs = s.danceByLights(ctx, startHues, ids, fade)
+	}
+	for id, err := range fallbackErrs {
+		if errs == nil {
+			errs = lightErrors{}
+		}
+		errs[id] = err
+	}
+	s.lastErrors = errs
+	if errs != nil {
+		return fmt.Errorf("failed to set dance mode: %w", errs)
+	}
+	for _, id := range ids {
+		s.reconcile.replace(id, huego.State{On: true, Effect: "colorloop"}, fade)
+	}
+	for _, id := range append(pulse, onOnly...) {
+		s.reconcile.replace(id, huego.State{On: true}, fade)
+	}
+	s.settle(fade)
+	s.position = position
+	return nil
+}
+
+// danceStartHues returns the starting hue of each light in a colorloop dance,
+// evenly offset by group, and the lights in group order.
+func danceStartHues(groups map[string][]int) (map[int]uint16, []int) {
 	keys := sortedKeys(groups)
 	n := len(keys)
+	startHues := map[int]uint16{}
+	var ids []int
 	for i, k := range keys {
 		startHue := uint16(1) // minimum 1: hue 0 is omitted by omitempty, 1 is indistinguishable visually
 		if n > 0 {
@@ -274,71 +848,359 @@ func (s *hueLightMode) activateDance(groups map[string][]int, position uint32) e
 			}
 		}
 		for _, id := range groups[k] {
-			light, err := s.bridge.GetLight(id)
-			if err != nil {
-				return fmt.Errorf("failed to get light %d: %w", id, err)
-			}
-			// Step 1: seed the starting hue and saturation (no effect yet).
-			if err := light.SetState(huego.State{
-				On:  true,
-				Hue: startHue,
-				Sat: 254,
-			}); err != nil {
-				return fmt.Errorf("failed to seed hue on light %d: %w", id, err)
-			}
-			// Step 2: start the colorloop from the seeded hue.
-			// On:true must be explicit — the bool field has no omitempty, so the
-			// zero value would serialize as "on":false and turn the light off.
-			if err := light.SetState(huego.State{
-				On:     true,
-				Effect: "colorloop",
-			}); err != nil {
-				return fmt.Errorf("failed to set dance mode on light %d: %w", id, err)
-			}
+			startHues[id] = startHue
+			ids = append(ids, id)
 		}
 	}
-	s.position = position
-	return nil
+	return startHues, ids
 }
 
-// activateDaylight sets each light to a cool daylight white (~6500 K, 153 mireds).
-func (s *hueLightMode) activateDaylight(lightIDs []int, position uint32) error {
+// danceByLights seeds and starts the colorloop on each light separately.
+func (s *hueLightMode) danceByLights(ctx context.Context, startHues map[int]uint16, ids []int, fade int) lightErrors {
+	return forEachLight(ctx, ids, func(ctx context.Context, id int) error {
+		// Step 1: seed the starting hue and saturation (no effect yet).
+		if err := setLightState(ctx, s.bridge, id, huego.State{
+			On:  true,
+			Hue: startHues[id],
+			Sat: 254,
+		}, fade); err != nil {
+			return fmt.Errorf("failed to seed hue: %w", err)
+		}
+		// Step 2: start the colorloop from the seeded hue.
+		// On:true must be explicit — the bool field has no omitempty, so the
+		// zero value would serialize as "on":false and turn the light off.
+		return setLightState(ctx, s.bridge, id, huego.State{
+			On:     true,
+			Effect: "colorloop",
+		}, fade)
+	})
+}
+
+// activateState puts each light in the state the mode defines for it. The
+// daylight and warm modes are state modes with fixed ct and brightness. The
+// fade comes from extra, then the state's transition_ms, then the config.
+func (s *hueLightMode) activateState(ctx context.Context, mode *lightMode, lightIDs []int, position uint32, extra map[string]interface{}) error {
+	longest := transitionDefault
+	fades := map[int]int{}
+	var ids []int
 	for _, id := range lightIDs {
-		light, err := s.bridge.GetLight(id)
-		if err != nil {
-			return fmt.Errorf("failed to get light %d: %w", id, err)
+		st := mode.stateFor(id)
+		if st == nil {
+			continue
+		}
+		configured := s.cfg.TransitionMs
+		if st.TransitionMs != nil {
+			configured = st.TransitionMs
 		}
-		if err := light.SetState(huego.State{
-			On:             true,
-			Bri:            254,
-			Ct:             153,
-			Effect:         "none",
-			TransitionTime: 4,
-		}); err != nil {
-			return fmt.Errorf("failed to set daylight mode on light %d: %w", id, err)
+		fade, err := transitionArg(extra, configured)
+		if err != nil {
+			return err
 		}
+		longest = max(longest, fade)
+		fades[id] = fade
+		ids = append(ids, id)
+	}
+
+	// Adapt each light's state to what it supports, e.g. ct for a color-only bulb.
+	caps := s.capsFor(ctx, ids)
+	states := make(map[int]huego.State, len(ids))
+	for _, id := range ids {
+		st, note := adaptState(mode.stateFor(id).hueState(), caps[id])
+		states[id] = st
+		s.noteDegraded(id, note)
 	}
+
+	var errs lightErrors
+	if !s.stateByGroup(ctx, mode.name, ids, states, fades) {
+		errs = forEachLight(ctx, ids, func(ctx context.Context, id int) error {
+			return setLightState(ctx, s.bridge, id, states[id], fades[id])
+		})
+	}
+	s.lastErrors = errs
+	if errs != nil {
+		return fmt.Errorf("failed to set %s mode: %w", mode.name, errs)
+	}
+	for _, id := range ids {
+		s.reconcile.replace(id, states[id], fades[id])
+	}
+	s.settle(longest)
 	s.position = position
 	return nil
 }
 
-// activateWarm sets each light to a warm incandescent white (~2700 K, 370 mireds).
-func (s *hueLightMode) activateWarm(lightIDs []int, position uint32) error {
-	for _, id := range lightIDs {
-		light, err := s.bridge.GetLight(id)
+// groupActions reports whether shared states may be sent to lights as group
+// actions. Lights with limits are always set one by one so each is checked.
+func (s *hueLightMode) groupActions(ids []int) bool {
+	return (s.cfg.GroupActions == nil || *s.cfg.GroupActions) && len(ids) >= 2 && !hasLimits(s.bridge, ids)
+}
+
+// setGroup applies state to exactly the given lights with one group action.
+func (s *hueLightMode) setGroup(ctx context.Context, lights []int, state huego.State, fade int) error {
+	gid, err := s.groups.groupFor(ctx, lights)
+	if err != nil {
+		return err
+	}
+	if err := setGroupState(ctx, s.bridge, gid, lights, state, fade); err != nil {
+		s.groups.forget(lights)
+		return fmt.Errorf("group %d: %w", gid, err)
+	}
+	return nil
+}
+
+// stateByGroup applies a state mode with one group action when every light
+// shares the same state and fade. It returns false when that is not possible
+// or the action fails, leaving the lights to the per-light path.
+func (s *hueLightMode) stateByGroup(ctx context.Context, modeName string, ids []int, states map[int]huego.State, fades map[int]int) bool {
+	if !s.groupActions(ids) {
+		return false
+	}
+	st, fade := states[ids[0]], fades[ids[0]]
+	for _, id := range ids[1:] {
+		if !reflect.DeepEqual(states[id], st) || fades[id] != fade {
+			return false
+		}
+	}
+	if err := s.setGroup(ctx, ids, st, fade); err != nil {
+		s.logger.Debugf("group action for %s mode failed, setting lights one by one: %v", modeName, err)
+		return false
+	}
+	return true
+}
+
+// stepLights applies a relative change such as {"bri_inc": 25} to the active
+// mode's lights, or to cmd["lights"], and returns their new states.
+func (s *hueLightMode) stepLights(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	body, err := stepBody(cmd)
+	if err != nil {
+		return nil, err
+	}
+	fade, err := transitionArg(cmd, s.cfg.TransitionMs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.activeLights
+	if v, ok := cmd["lights"]; ok {
+		if err := decodeArg(v, &ids); err != nil {
+			return nil, fmt.Errorf("invalid lights: %w", err)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no mode is active, pass \"lights\" to choose the lights to change")
+	}
+	if ok, err := s.claim.acquire(s.bridge, ids, func(ctx context.Context) error {
+		_, err := s.stepLights(ctx, cmd)
+		return err
+	}); !ok {
+		return deferredResult(err)
+	}
+	ctx = withClaimant(ctx, s.claim)
+
+	var errs lightErrors
+	if !s.stepByGroup(ctx, ids, body, fade) {
+		errs = forEachLight(ctx, ids, func(ctx context.Context, id int) error {
+			return sendLightStep(ctx, s.bridge, id, body, fade)
+		})
+	}
+	// Lights outside the active mode and any running job are only held
+	// while the change is sent.
+	s.claim.keep(s.bridge, s.heldLights())
+
+	states, err := s.snapshotLights(ids)
+	if err != nil {
+		return nil, err
+	}
+	lights := make(map[string]interface{}, len(states))
+	for id, st := range states {
+		lights[strconv.Itoa(id)] = stateToMap(st)
+		if _, failed := errs[id]; !failed {
+			s.reconcile.replace(id, commandFromState(st), fade)
+		}
+	}
+	return map[string]interface{}{"lights": lights, "failed_lights": errs.toMap()}, nil
+}
+
+// stepByGroup sends a relative change to all lights with one group action. It
+// returns false when that is not possible or fails, leaving the lights to be
+// changed one by one.
+func (s *hueLightMode) stepByGroup(ctx context.Context, ids []int, body map[string]interface{}, fade int) bool {
+	if !s.groupActions(ids) {
+		return false
+	}
+	gid, err := s.groups.groupFor(ctx, ids)
+	if err == nil {
+		err = waitForBridgeGroups(ctx, s.bridge)
+	}
+	if err == nil {
+		err = sendStep(ctx, s.bridge, fmt.Sprintf("/groups/%d/action", gid), body, fade)
+	}
+	if err != nil {
+		s.groups.forget(ids)
+		s.logger.Debugf("group action for relative change failed, changing lights one by one: %v", err)
+		return false
+	}
+	for _, id := range ids {
+		forgetCommand(s.bridge, id)
+	}
+	return true
+}
+
+// noteDegraded records how the active mode was adapted for a light.
+func (s *hueLightMode) noteDegraded(id int, note string) {
+	if note == "" {
+		return
+	}
+	if s.degraded == nil {
+		s.degraded = map[int]string{}
+	}
+	s.degraded[id] = note
+	s.logger.Infof("light %d: %s", id, note)
+}
+
+func degradedToMap(degraded map[int]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(degraded))
+	for id, note := range degraded {
+		out[strconv.Itoa(id)] = note
+	}
+	return out
+}
+
+// splitDanceLights removes lights without color from the dance groups,
+// returning the dimmable ones to pulse and the on/off ones to just turn on.
+func (s *hueLightMode) splitDanceLights(ctx context.Context, groups map[string][]int) (color map[string][]int, pulse, onOnly []int) {
+	caps := s.capsFor(ctx, flattenDanceGroups(groups))
+	color = make(map[string][]int, len(groups))
+	for k, ids := range groups {
+		for _, id := range ids {
+			switch c := caps[id]; {
+			case c.color:
+				color[k] = append(color[k], id)
+			case c.dim:
+				pulse = append(pulse, id)
+				s.noteDegraded(id, "colorloop shown as brightness pulse")
+			default:
+				onOnly = append(onOnly, id)
+				s.noteDegraded(id, "colorloop not supported, turned on only")
+			}
+		}
+	}
+	return color, pulse, onOnly
+}
+
+// startDanceFallbacks turns on the on/off lights of a dance and starts a
+// brightness pulse on the dimmable ones, returning the lights that failed.
+func (s *hueLightMode) startDanceFallbacks(ctx context.Context, pulse, onOnly []int) lightErrors {
+	errs := forEachLight(ctx, onOnly, func(ctx context.Context, id int) error {
+		return setLightState(ctx, s.bridge, id, huego.State{On: true}, transitionDefault)
+	})
+	if len(pulse) == 0 {
+		return errs
+	}
+	e, err := newEffect(&EffectConfig{Type: "breathe"}, pulse)
+	if err != nil {
+		s.logger.Warnf("failed to start brightness pulse for lights %v: %v", pulse, err)
+		return errs
+	}
+	s.jobs.start(s.bridge, e, s.logger, nil)
+	return errs
+}
+
+// danceByGroups seeds each dance group's starting hue with one group action,
+// then starts the colorloop on all lights with another, so every light starts
+// looping at the same moment. It returns false when group actions are off or
+// fail, leaving the lights to the per-light path.
+func (s *hueLightMode) danceByGroups(ctx context.Context, groups map[string][]int, startHues map[int]uint16, ids []int, fade int) bool {
+	if !s.groupActions(ids) {
+		return false
+	}
+	for _, k := range sortedKeys(groups) {
+		members := groups[k]
+		if len(members) == 0 {
+			continue
+		}
+		seed := huego.State{On: true, Hue: startHues[members[0]], Sat: 254}
+		var err error
+		if len(members) == 1 {
+			err = setLightState(ctx, s.bridge, members[0], seed, fade)
+		} else {
+			err = s.setGroup(ctx, members, seed, fade)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to get light %d: %w", id, err)
+			s.logger.Debugf("group action for dance group %q failed, setting lights one by one: %v", k, err)
+			return false
 		}
-		if err := light.SetState(huego.State{
-			On:             true,
-			Bri:            200,
-			Ct:             370,
-			Effect:         "none",
-			TransitionTime: 4,
-		}); err != nil {
-			return fmt.Errorf("failed to set warm mode on light %d: %w", id, err)
+	}
+	if err := s.setGroup(ctx, ids, huego.State{On: true, Effect: "colorloop"}, fade); err != nil {
+		s.logger.Debugf("group action for dance mode failed, setting lights one by one: %v", err)
+		return false
+	}
+	return true
+}
+
+// settle holds off drift checks until a fade of fadeMs has finished.
+func (s *hueLightMode) settle(fadeMs int) {
+	if fadeMs < 0 {
+		fadeMs = 400 // bridge default
+	}
+	s.settleAt = time.Now().Add(time.Duration(fadeMs)*time.Millisecond + driftSettle)
+}
+
+// activateDrivenDance starts a dance whose palette and speed the module
+// drives. It keeps running until the position changes or the component closes.
+func (s *hueLightMode) activateDrivenDance(ctx context.Context, mode *lightMode, position uint32) error {
+	caps := s.capsFor(ctx, flattenDanceGroups(mode.dance))
+	for id, c := range caps {
+		switch {
+		case c.color:
+		case c.dim:
+			s.noteDegraded(id, "palette shown as brightness pulse")
+		default:
+			s.noteDegraded(id, "palette not supported, turned on only")
 		}
 	}
+	d, err := newDance(mode.danceStyle, mode.dance, caps)
+	if err != nil {
+		return err
+	}
+	s.jobs.start(s.bridge, d, s.logger, nil)
+	s.position = position
+	return nil
+}
+
+// activateEffect starts the mode's animation on its lights. It keeps running
+// until the position changes or the component closes.
+func (s *hueLightMode) activateEffect(mode *lightMode, lightIDs []int, position uint32) error {
+	e, err := newEffect(mode.effect, lightIDs)
+	if err != nil {
+		return err
+	}
+	s.jobs.start(s.bridge, e, s.logger, nil)
+	s.position = position
+	return nil
+}
+
+// activateRoutine starts the mode's sunrise or sunset ramp. The position stays
+// on the mode after the ramp completes; routine_status reports progress.
+func (s *hueLightMode) activateRoutine(mode *lightMode, lightIDs []int, position uint32) error {
+	r, err := newRoutine(mode.routine, lightIDs)
+	if err != nil {
+		return err
+	}
+	s.jobs.start(s.bridge, r, s.logger, nil)
+	s.position = position
+	return nil
+}
+
+// activateCircadian starts the mode's circadian updates, which run until the
+// position changes.
+func (s *hueLightMode) activateCircadian(mode *lightMode, lightIDs []int, position uint32) error {
+	c, err := newCircadian(mode.circadian, lightIDs)
+	if err != nil {
+		return err
+	}
+	s.jobs.start(s.bridge, c, s.logger, nil)
 	s.position = position
 	return nil
 }
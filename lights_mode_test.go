@@ -0,0 +1,218 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// newTestLightMode builds a hue-lights-mode component on a fake bridge.
+func newTestLightMode(t *testing.T, f *fakeBridge, cfg *LightModeConfig) *hueLightMode {
+	cfg.BridgeHost = f.server.URL
+	cfg.Username = "user"
+	if _, _, err := cfg.Validate(""); err != nil {
+		t.Fatal(err)
+	}
+	sw, err := newHueLightMode(context.Background(), nil, resource.Config{
+		Name:                "mode",
+		API:                 toggleswitch.API,
+		Model:               HueLightMode,
+		ConvertedAttributes: cfg,
+	}, logging.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sw.(*hueLightMode)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestDriftReapplyOnlyDriftedLights(t *testing.T) {
+	f := newFakeBridge(t)
+	for id := 1; id <= 3; id++ {
+		f.addLight(id, nil)
+	}
+	noFade, noGroups := 0, false
+	s := newTestLightMode(t, f, &LightModeConfig{
+		Daylight:     []int{1, 2, 3},
+		DriftCheck:   driftReapply,
+		TransitionMs: &noFade,
+		GroupActions: &noGroups,
+	})
+	ctx := context.Background()
+	if err := s.SetPosition(ctx, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(driftSettle + 100*time.Millisecond)
+	before := len(f.writes("/lights/"))
+
+	f.addLight(2, map[string]interface{}{"on": true, "bri": 10})
+	if pos, err := s.GetPosition(ctx, nil); err != nil || pos != 2 {
+		t.Fatalf("GetPosition = %d, %v, want 2", pos, err)
+	}
+	s.reapplying.Wait()
+
+	writes := f.writes("/lights/")[before:]
+	if len(writes) == 0 {
+		t.Fatal("the drifted light was not re-applied")
+	}
+	for _, w := range writes {
+		if w.path != "/lights/2/state" {
+			t.Errorf("re-apply wrote %s, want only light 2", w.path)
+		}
+	}
+	if st := f.state(2); st["on"] != true || st["bri"] == 10.0 {
+		t.Errorf("light 2 = %v after the re-apply", st)
+	}
+}
+
+func TestBaselineKeptAcrossModes(t *testing.T) {
+	f := newFakeBridge(t)
+	f.addLight(1, map[string]interface{}{"on": true, "bri": 50, "colormode": "ct", "ct": 400})
+	f.addLight(2, map[string]interface{}{"on": false, "bri": 90, "colormode": "xy", "xy": []interface{}{0.5, 0.4}})
+	noFade, noGroups := 0, false
+	s := newTestLightMode(t, f, &LightModeConfig{
+		Daylight:     []int{1},
+		Warm:         []int{1, 2},
+		DriftCheck:   driftOff,
+		TransitionMs: &noFade,
+		GroupActions: &noGroups,
+	})
+	ctx := context.Background()
+	baseline := func() map[string]interface{} {
+		out, err := s.DoCommand(ctx, map[string]interface{}{"get_baseline": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out["lights"].(map[string]interface{})
+	}
+
+	// none -> daylight -> warm keeps light 1's original state and adds light 2's.
+	if err := s.SetPosition(ctx, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPosition(ctx, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := baseline()
+	if len(got) != 2 {
+		t.Fatalf("baseline = %v, want lights 1 and 2", got)
+	}
+	if l1 := got["1"].(map[string]interface{}); l1["ct"] != 400 || l1["bri"] != 50 {
+		t.Errorf("light 1 baseline = %v, want its state from before daylight", l1)
+	}
+
+	if err := s.SetPosition(ctx, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if st := f.state(1); st["on"] != true || st["bri"] != 50.0 || st["ct"] != 400.0 {
+		t.Errorf("light 1 = %v after none, want its original state", st)
+	}
+	if st := f.state(2); st["on"] != false {
+		t.Errorf("light 2 = %v after none, want it off again", st)
+	}
+	if got := baseline(); len(got) != 0 {
+		t.Errorf("baseline = %v after none, want it empty", got)
+	}
+
+	// clear_baseline makes none leave the lights as they are.
+	if err := s.SetPosition(ctx, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.DoCommand(ctx, map[string]interface{}{"clear_baseline": true})
+	if err != nil || out["cleared"] != 1 {
+		t.Fatalf("clear_baseline = %v, %v, want 1 cleared", out, err)
+	}
+	before := len(f.writes("/lights/"))
+	if err := s.SetPosition(ctx, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.writes("/lights/")) - before; n != 0 {
+		t.Errorf("none wrote %d times after clear_baseline, want 0", n)
+	}
+}
+
+func TestRestoreOnClose(t *testing.T) {
+	for _, restore := range []bool{false, true} {
+		t.Run(fmt.Sprint(restore), func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, map[string]interface{}{"on": true, "bri": 50, "colormode": "ct", "ct": 400})
+			noFade := 0
+			s := newTestLightMode(t, f, &LightModeConfig{
+				Daylight:       []int{1},
+				DriftCheck:     driftOff,
+				TransitionMs:   &noFade,
+				RestoreOnClose: restore,
+			})
+			if err := s.SetPosition(context.Background(), 2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.state(1)["ct"] == 400.0; got != restore {
+				t.Errorf("light 1 = %v after close, restored %v, want %v", f.state(1), got, restore)
+			}
+		})
+	}
+}
+
+func TestRollbackPartlyFailedMode(t *testing.T) {
+	for _, bestEffort := range []bool{false, true} {
+		t.Run(fmt.Sprintf("best_effort=%v", bestEffort), func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, map[string]interface{}{"on": true, "bri": 50, "colormode": "ct", "ct": 400})
+			f.addLight(2, nil)
+			f.routes["PUT /lights/2/state"] = []map[string]interface{}{{"error": map[string]interface{}{"description": "light unreachable"}}}
+			noFade, noGroups := 0, false
+			s := newTestLightMode(t, f, &LightModeConfig{
+				Daylight:     []int{1, 2},
+				DriftCheck:   driftOff,
+				TransitionMs: &noFade,
+				GroupActions: &noGroups,
+				BestEffort:   bestEffort,
+			})
+			ctx := context.Background()
+			err := s.SetPosition(ctx, 2, nil)
+
+			var actErr *activationError
+			var failed lightErrors
+			if !errors.As(err, &failed) || len(failed) != 1 || failed[2] == nil {
+				t.Fatalf("SetPosition = %v, want light 2 to fail", err)
+			}
+			status, _ := s.DoCommand(ctx, map[string]interface{}{"mode_status": true})
+			pos, _ := s.GetPosition(ctx, nil)
+			if bestEffort {
+				if errors.As(err, &actErr) || status["rolled_back"] == true {
+					t.Errorf("best_effort rolled back: %v", err)
+				}
+				if pos != 0 || f.state(1)["ct"] != 153.0 {
+					t.Errorf("position %d, light 1 = %v, want daylight kept and the position unchanged", pos, f.state(1))
+				}
+				return
+			}
+			if !errors.As(err, &actErr) || actErr.rollbackFailed[2] == nil {
+				t.Fatalf("SetPosition = %v, want a rollback that could not reach light 2", err)
+			}
+			if status["rolled_back"] != true {
+				t.Errorf("mode_status = %v, want rolled_back", status)
+			}
+			if pos != 0 {
+				t.Errorf("position = %d after a rollback, want 0", pos)
+			}
+			if st := f.state(1); st["ct"] != 400.0 || st["bri"] != 50.0 {
+				t.Errorf("light 1 = %v, want it rolled back", st)
+			}
+			baseline, _ := s.DoCommand(ctx, map[string]interface{}{"get_baseline": true})
+			if lights := baseline["lights"].(map[string]interface{}); len(lights) != 0 {
+				t.Errorf("baseline = %v after a rollback from none, want it empty", lights)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package hue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// LightLimits bounds what the module may set a light to, e.g. a light that
+// must never be brighter than half or must stay dim overnight.
+type LightLimits struct {
+	MinBrightness float64      `json:"min_brightness,omitempty"` // percent
+	MaxBrightness float64      `json:"max_brightness,omitempty"` // percent
+	MinCt         uint16       `json:"min_ct,omitempty"`         // mireds, the coolest white allowed
+	MaxCt         uint16       `json:"max_ct,omitempty"`         // mireds, the warmest white allowed
+	QuietHours    []QuietHours `json:"quiet_hours,omitempty"`
+	Timezone      string       `json:"timezone,omitempty"` // IANA name for quiet_hours, default local time
+}
+
+// QuietHours caps or blocks changes during a daily time window.
+type QuietHours struct {
+	Start         string  `json:"start"`                    // "HH:MM"
+	End           string  `json:"end"`                      // "HH:MM", before start to span midnight
+	MaxBrightness float64 `json:"max_brightness,omitempty"` // percent cap inside the window
+	Block         bool    `json:"block,omitempty"`          // reject every change except turning lights off
+}
+
+func (l *LightLimits) validate() error {
+	for _, b := range []float64{l.MinBrightness, l.MaxBrightness} {
+		if b < 0 || b > 100 {
+			return fmt.Errorf("limits brightness must be 1-100, got %v", b)
+		}
+	}
+	if l.MaxBrightness != 0 && l.MinBrightness > l.MaxBrightness {
+		return fmt.Errorf("limits min_brightness %v is above max_brightness %v", l.MinBrightness, l.MaxBrightness)
+	}
+	for _, ct := range []uint16{l.MinCt, l.MaxCt} {
+		if ct != 0 && (ct < 153 || ct > 500) {
+			return fmt.Errorf("limits ct must be 153-500 mireds, got %d", ct)
+		}
+	}
+	if l.MaxCt != 0 && l.MinCt > l.MaxCt {
+		return fmt.Errorf("limits min_ct %d is above max_ct %d", l.MinCt, l.MaxCt)
+	}
+	for i, q := range l.QuietHours {
+		if _, err := parseClock(q.Start); err != nil {
+			return fmt.Errorf("quiet_hours %d start: %w", i, err)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return fmt.Errorf("quiet_hours %d end: %w", i, err)
+		}
+		if q.MaxBrightness < 0 || q.MaxBrightness > 100 {
+			return fmt.Errorf("quiet_hours %d max_brightness must be 1-100, got %v", i, q.MaxBrightness)
+		}
+		if !q.Block && q.MaxBrightness == 0 {
+			return fmt.Errorf("quiet_hours %d needs max_brightness or block", i)
+		}
+	}
+	if l.Timezone != "" {
+		if _, err := time.LoadLocation(l.Timezone); err != nil {
+			return fmt.Errorf("invalid limits timezone: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time must be HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// location is the time zone quiet hours are given in.
+func (l *LightLimits) location() *time.Location {
+	if l.Timezone != "" {
+		if loc, err := time.LoadLocation(l.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// activeQuietHours returns the quiet hours windows that contain now, which
+// must be in the limits' location.
+func (l *LightLimits) activeQuietHours(now time.Time) []QuietHours {
+	m := now.Hour()*60 + now.Minute()
+
+	var active []QuietHours
+	for _, q := range l.QuietHours {
+		start, _ := parseClock(q.Start)
+		end, _ := parseClock(q.End)
+		in := start <= m && m < end
+		if end <= start {
+			in = m >= start || m < end // spans midnight
+		}
+		if in {
+			active = append(active, q)
+		}
+	}
+	return active
+}
+
+// enforce returns state brought within the limits at now, given in the
+// limits' location, describing each change made, or an error if quiet hours
+// block it. Turning a light off is always allowed. A state that turns a light
+// on without a brightness gets the capped brightness, since the light would
+// otherwise come back at whatever it had before; other unset fields are not
+// touched.
+func (l *LightLimits) enforce(state huego.State, now time.Time) (huego.State, []string, error) {
+	if !state.On {
+		return state, nil, nil
+	}
+	minBri, maxBri := l.MinBrightness, l.MaxBrightness
+	for _, q := range l.activeQuietHours(now) {
+		if q.Block {
+			return state, nil, fmt.Errorf("blocked by quiet hours %s-%s", q.Start, q.End)
+		}
+		if maxBri == 0 || q.MaxBrightness < maxBri {
+			maxBri = q.MaxBrightness
+		}
+	}
+
+	var notes []string
+	if state.Bri == 0 && maxBri > 0 {
+		state.Bri = percentToBri(maxBri)
+	} else if state.Bri != 0 {
+		if maxBri > 0 && state.Bri > percentToBri(maxBri) {
+			notes = append(notes, fmt.Sprintf("brightness %d capped to %d", state.Bri, percentToBri(maxBri)))
+			state.Bri = percentToBri(maxBri)
+		}
+		if minBri > 0 && state.Bri < percentToBri(minBri) {
+			notes = append(notes, fmt.Sprintf("brightness %d raised to %d", state.Bri, percentToBri(minBri)))
+			state.Bri = percentToBri(minBri)
+		}
+	}
+	if state.Ct != 0 {
+		if l.MaxCt != 0 && state.Ct > l.MaxCt {
+			notes = append(notes, fmt.Sprintf("ct %d limited to %d", state.Ct, l.MaxCt))
+			state.Ct = l.MaxCt
+		}
+		if l.MinCt != 0 && state.Ct < l.MinCt {
+			notes = append(notes, fmt.Sprintf("ct %d limited to %d", state.Ct, l.MinCt))
+			state.Ct = l.MinCt
+		}
+	}
+	return state, notes, nil
+}
+
+// limitOwner is a component, or one of its modes, that set limits on lights.
+type limitOwner struct {
+	limits *LightLimits
+	loc    *time.Location
+	logger logging.Logger
+}
+
+// limitViolation is the last time a light's limits changed or blocked a write.
+type limitViolation struct {
+	at       time.Time
+	message  string
+	loggedAt time.Time
+}
+
+var (
+	lightLimitsMu sync.Mutex
+	lightLimits   = map[string]map[string]limitOwner{} // bridge/light ID -> owner name -> limits
+	violations    = map[string]limitViolation{}        // bridge/light ID -> last violation
+)
+
+// registerLimits applies limits to every write the module makes to lights,
+// whichever component makes it, until unregisterLimits is called for owner.
+func registerLimits(bridge *huego.Bridge, owner string, ids []int, limits *LightLimits, logger logging.Logger) {
+	if limits == nil {
+		return
+	}
+	loc := limits.location()
+	lightLimitsMu.Lock()
+	defer lightLimitsMu.Unlock()
+	for _, id := range ids {
+		key := commandedKey(bridge, id)
+		if lightLimits[key] == nil {
+			lightLimits[key] = map[string]limitOwner{}
+		}
+		lightLimits[key][owner] = limitOwner{limits: limits, loc: loc, logger: logger}
+	}
+}
+
+// unregisterLimits removes the limits owner set on any of the bridge's lights.
+func unregisterLimits(bridge *huego.Bridge, owner string) {
+	prefix := bridgeKey(bridge) + "/"
+	lightLimitsMu.Lock()
+	defer lightLimitsMu.Unlock()
+	for key, owners := range lightLimits {
+		if strings.HasPrefix(key, prefix) {
+			delete(owners, owner)
+			if len(owners) == 0 {
+				delete(lightLimits, key)
+			}
+		}
+	}
+}
+
+// hasLimits reports whether any of the lights has limits, in which case they
+// must be written one by one rather than by a group action.
+func hasLimits(bridge *huego.Bridge, ids []int) bool {
+	lightLimitsMu.Lock()
+	defer lightLimitsMu.Unlock()
+	for _, id := range ids {
+		if len(lightLimits[commandedKey(bridge, id)]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// violationLogInterval keeps an animation that keeps hitting a limit from
+// logging every frame.
+const violationLogInterval = time.Minute
+
+// applyLimits brings a state about to be sent to a light within every limit
+// set on it, logging and recording any change, or returns an error if quiet
+// hours block the write.
+func applyLimits(bridge *huego.Bridge, id int, state huego.State) (huego.State, error) {
+	return limitState(bridge, id, state, true)
+}
+
+// limitedState returns the state a light will actually be set to for state,
+// without recording anything. A blocked state is returned unchanged.
+func limitedState(bridge *huego.Bridge, id int, state huego.State) huego.State {
+	limited, err := limitState(bridge, id, state, false)
+	if err != nil {
+		return state
+	}
+	return limited
+}
+
+func limitState(bridge *huego.Bridge, id int, state huego.State, record bool) (huego.State, error) {
+	key := commandedKey(bridge, id)
+	lightLimitsMu.Lock()
+	defer lightLimitsMu.Unlock()
+	owners := lightLimits[key]
+	if len(owners) == 0 {
+		return state, nil
+	}
+
+	names := make([]string, 0, len(owners))
+	for name := range owners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := time.Now()
+	report := func(o limitOwner, msg string) {
+		if !record {
+			return
+		}
+		v := violations[key]
+		if v.message != msg || now.Sub(v.loggedAt) >= violationLogInterval {
+			o.logger.Infof("light %d: %s", id, msg)
+			v.loggedAt = now
+		}
+		v.at, v.message = now, msg
+		violations[key] = v
+	}
+	for _, name := range names {
+		o := owners[name]
+		limited, notes, err := o.limits.enforce(state, now.In(o.loc))
+		if err != nil {
+			msg := fmt.Sprintf("%s: %v", name, err)
+			report(o, msg)
+			return state, fmt.Errorf("light %d %s", id, msg)
+		}
+		if len(notes) > 0 {
+			report(o, fmt.Sprintf("%s: %s", name, strings.Join(notes, ", ")))
+		}
+		state = limited
+	}
+	return state, nil
+}
+
+// limitViolations reports the last limit violation of each light that had
+// one, keyed by light ID, for DoCommand results.
+func limitViolations(bridge *huego.Bridge, ids []int) map[string]interface{} {
+	lightLimitsMu.Lock()
+	defer lightLimitsMu.Unlock()
+	out := map[string]interface{}{}
+	for _, id := range ids {
+		if v, ok := violations[commandedKey(bridge, id)]; ok {
+			out[fmt.Sprint(id)] = map[string]interface{}{
+				"message": v.message,
+				"at":      v.at.Format(time.RFC3339),
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package hue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+func TestLightLimitsEnforce(t *testing.T) {
+	limits := &LightLimits{
+		MinBrightness: 10,
+		MaxBrightness: 80,
+		MinCt:         200,
+		MaxCt:         400,
+		QuietHours: []QuietHours{
+			{Start: "22:00", End: "06:00", MaxBrightness: 20},
+			{Start: "02:00", End: "03:00", Block: true},
+		},
+	}
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	blocked := time.Date(2024, 1, 1, 2, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		state   huego.State
+		now     time.Time
+		want    huego.State
+		notes   int
+		wantErr bool
+	}{
+		{"within limits", huego.State{On: true, Bri: 100, Ct: 300}, day, huego.State{On: true, Bri: 100, Ct: 300}, 0, false},
+		{"capped", huego.State{On: true, Bri: 254}, day, huego.State{On: true, Bri: percentToBri(80)}, 1, false},
+		{"raised", huego.State{On: true, Bri: 1}, day, huego.State{On: true, Bri: percentToBri(10)}, 1, false},
+		{"ct too warm", huego.State{On: true, Ct: 500}, day, huego.State{On: true, Bri: percentToBri(80), Ct: 400}, 1, false},
+		{"ct too cool", huego.State{On: true, Ct: 153}, day, huego.State{On: true, Bri: percentToBri(80), Ct: 200}, 1, false},
+		{"on without bri gets the cap", huego.State{On: true, Effect: "colorloop"}, day, huego.State{On: true, Bri: percentToBri(80), Effect: "colorloop"}, 0, false},
+		{"on without bri at night", huego.State{On: true, Hue: 100, Sat: 254}, night, huego.State{On: true, Bri: percentToBri(20)}, 0, false},
+		{"quiet hours cap", huego.State{On: true, Bri: 200}, night, huego.State{On: true, Bri: percentToBri(20)}, 1, false},
+		{"quiet hours block", huego.State{On: true, Bri: 10}, blocked, huego.State{}, 0, true},
+		{"off allowed when blocked", huego.State{On: false, Bri: 254}, blocked, huego.State{On: false, Bri: 254}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes, err := limits.enforce(tt.state, tt.now)
+			tt.want.Hue, tt.want.Sat = tt.state.Hue, tt.state.Sat // never touched
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("enforce = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.On != tt.want.On || got.Bri != tt.want.Bri || got.Ct != tt.want.Ct || got.Effect != tt.want.Effect {
+				t.Errorf("enforce = %+v, want %+v", got, tt.want)
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("enforce notes = %v, want %d", notes, tt.notes)
+			}
+		})
+	}
+}
+
+func TestApplyLimits(t *testing.T) {
+	bridge := huego.New("limits-test", "user")
+	logger := logging.NewTestLogger(t)
+	registerLimits(bridge, "a", []int{1, 2}, &LightLimits{MaxBrightness: 50}, logger)
+	registerLimits(bridge, "b", []int{1}, &LightLimits{MaxBrightness: 20, MaxCt: 300}, logger)
+	defer unregisterLimits(bridge, "a")
+	defer unregisterLimits(bridge, "b")
+
+	tests := []struct {
+		name string
+		id   int
+		in   huego.State
+		want huego.State
+	}{
+		{"every owner applies", 1, huego.State{On: true, Bri: 254, Ct: 400}, huego.State{On: true, Bri: percentToBri(20), Ct: 300}},
+		{"one owner", 2, huego.State{On: true, Bri: 254, Ct: 400}, huego.State{On: true, Bri: percentToBri(50), Ct: 400}},
+		{"no limits", 3, huego.State{On: true, Bri: 254}, huego.State{On: true, Bri: 254}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyLimits(bridge, tt.id, tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bri != tt.want.Bri || got.Ct != tt.want.Ct {
+				t.Errorf("applyLimits = %+v, want %+v", got, tt.want)
+			}
+			if limited := limitedState(bridge, tt.id, tt.in); limited.Bri != got.Bri || limited.Ct != got.Ct {
+				t.Errorf("limitedState = %+v, want %+v", limited, got)
+			}
+		})
+	}
+	if !hasLimits(bridge, []int{2, 3}) || hasLimits(bridge, []int{3}) {
+		t.Error("hasLimits does not match the registered lights")
+	}
+
+	unregisterLimits(bridge, "b")
+	if got, _ := applyLimits(bridge, 1, huego.State{On: true, Bri: 254}); got.Bri != percentToBri(50) {
+		t.Errorf("after unregistering b, bri = %d, want %d", got.Bri, percentToBri(50))
+	}
+}
+
+func TestQuietHoursLetDimmingThrough(t *testing.T) {
+	f := newFakeBridge(t)
+	f.addLight(1, map[string]interface{}{"on": true, "bri": 100})
+	now := time.Now()
+	block := &LightLimits{QuietHours: []QuietHours{{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+		Block: true,
+	}}}
+	registerLimits(f.Bridge, "test", []int{1}, block, logging.NewTestLogger(t))
+	defer unregisterLimits(f.Bridge, "test")
+
+	tests := []struct {
+		name    string
+		cmd     map[string]interface{}
+		blocked bool
+	}{
+		{"dimmer", map[string]interface{}{"bri_inc": -20.0}, false},
+		{"brighter", map[string]interface{}{"bri_inc": 20.0}, true},
+		{"dimmer and warmer", map[string]interface{}{"bri_inc": -20.0, "ct_inc": 10.0}, true},
+		{"warmer", map[string]interface{}{"ct_inc": 10.0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := stepBody(tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sendLightStep(context.Background(), f.Bridge, 1, body, transitionDefault)
+			if blocked := err != nil; blocked != tt.blocked {
+				t.Errorf("sendLightStep error = %v, want blocked %v", err, tt.blocked)
+			}
+		})
+	}
+}
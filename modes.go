@@ -0,0 +1,333 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/amimof/huego"
+)
+
+// Mode kinds understood by hue-lights-mode.
+const (
+	modeKindState     = "state"     // apply a fixed per-light state
+	modeKindDance     = "dance"     // staggered colorloop across groups of lights
+	modeKindEffect    = "effect"    // software animation driven by the module
+	modeKindRoutine   = "routine"   // gradual sunrise or sunset ramp
+	modeKindCircadian = "circadian" // follows the sun or a daily curve
+)
+
+// ModeConfig defines one named position of hue-lights-mode.
+type ModeConfig struct {
+	Name        string                     `json:"name"`
+	Type        string                     `json:"type,omitempty"`         // "state" (default), "dance", "effect", "routine" or "circadian"
+	Lights      []int                      `json:"lights,omitempty"`       // light IDs
+	Groups      []int                      `json:"groups,omitempty"`       // bridge room/zone IDs, expanded to their lights
+	State       *ModeLightState            `json:"state,omitempty"`        // state applied to every light
+	LightStates map[string]*ModeLightState `json:"light_states,omitempty"` // light ID -> state overriding State
+	DanceGroups map[string][]int           `json:"dance_groups,omitempty"` // for "dance": group name -> light IDs
+	DanceStyle  *DanceStyle                `json:"dance_style,omitempty"`  // for "dance": palette, speed and phase
+	Effect      *EffectConfig              `json:"effect,omitempty"`       // for "effect": the animation to run
+	Routine     *RoutineConfig             `json:"routine,omitempty"`      // for "routine": the ramp to run
+	Circadian   *CircadianConfig           `json:"circadian,omitempty"`    // for "circadian": how light follows the day
+	Limits      *LightLimits               `json:"limits,omitempty"`       // bounds on the lights while the mode is active
+}
+
+// ModeLightState is the state a mode puts a light in. Unset fields are left as
+// they are on the light. At most one of ct, xy, rgb and hex may be set.
+type ModeLightState struct {
+	On           *bool     `json:"on,omitempty"`         // defaults to true
+	Brightness   *float64  `json:"brightness,omitempty"` // percent, 1-100
+	Ct           uint16    `json:"ct,omitempty"`         // mireds, 153-500
+	Xy           []float64 `json:"xy,omitempty"`
+	RGB          []int     `json:"rgb,omitempty"`
+	Hex          string    `json:"hex,omitempty"`
+	Effect       string    `json:"effect,omitempty"` // "none" or "colorloop"
+	TransitionMs *int      `json:"transition_ms,omitempty"`
+}
+
+func (st *ModeLightState) validate() error {
+	if st.Brightness != nil && (*st.Brightness < 1 || *st.Brightness > 100) {
+		return fmt.Errorf("brightness must be 1-100, got %v", *st.Brightness)
+	}
+	if st.Ct != 0 && (st.Ct < 153 || st.Ct > 500) {
+		return fmt.Errorf("ct must be 153-500 mireds, got %d", st.Ct)
+	}
+
+	colors := 0
+	if st.Ct != 0 {
+		colors++
+	}
+	if st.Xy != nil {
+		colors++
+		if len(st.Xy) != 2 || st.Xy[0] < 0 || st.Xy[0] > 1 || st.Xy[1] < 0 || st.Xy[1] > 1 {
+			return fmt.Errorf("xy must be two values between 0 and 1, got %v", st.Xy)
+		}
+	}
+	if st.RGB != nil {
+		colors++
+		if len(st.RGB) != 3 {
+			return fmt.Errorf("rgb must have 3 values, got %v", st.RGB)
+		}
+		for _, c := range st.RGB {
+			if c < 0 || c > 255 {
+				return fmt.Errorf("rgb values must be 0-255, got %v", st.RGB)
+			}
+		}
+	}
+	if st.Hex != "" {
+		colors++
+		if _, _, _, err := parseHexColor(st.Hex); err != nil {
+			return err
+		}
+	}
+	if colors > 1 {
+		return fmt.Errorf("only one of ct, xy, rgb and hex may be set")
+	}
+
+	switch st.Effect {
+	case "", "none", "colorloop":
+	default:
+		return fmt.Errorf("effect must be \"none\" or \"colorloop\", got %q", st.Effect)
+	}
+	if st.TransitionMs != nil {
+		if err := validateTransitionMs(*st.TransitionMs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hueState converts the mode state into a bridge state. The fade is applied
+// separately, since huego cannot send a transition time of zero.
+func (st *ModeLightState) hueState() huego.State {
+	if st.On != nil && !*st.On {
+		return huego.State{On: false}
+	}
+
+	state := huego.State{On: true, Effect: st.Effect, Ct: st.Ct}
+	if st.Brightness != nil {
+		state.Bri = max(uint8(math.Round(*st.Brightness/100*254)), 1)
+	}
+	switch {
+	case st.Xy != nil:
+		state.Xy = []float32{float32(st.Xy[0]), float32(st.Xy[1])}
+	case st.RGB != nil:
+		x, y := rgbToXY(uint8(st.RGB[0]), uint8(st.RGB[1]), uint8(st.RGB[2]))
+		state.Xy = []float32{x, y}
+	case st.Hex != "":
+		r, g, b, _ := parseHexColor(st.Hex)
+		x, y := rgbToXY(r, g, b)
+		state.Xy = []float32{x, y}
+	}
+	return state
+}
+
+func (m *ModeConfig) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("every mode needs a name")
+	}
+	if m.Name == "none" {
+		return fmt.Errorf("mode name \"none\" is reserved")
+	}
+
+	switch m.Type {
+	case "", modeKindState:
+		if len(m.Lights) == 0 && len(m.Groups) == 0 && len(m.LightStates) == 0 {
+			return fmt.Errorf("mode %q needs lights, groups, or light_states", m.Name)
+		}
+		if m.State == nil {
+			if len(m.Groups) > 0 {
+				return fmt.Errorf("mode %q uses groups, so it needs a state", m.Name)
+			}
+			for _, id := range m.Lights {
+				if _, ok := m.LightStates[strconv.Itoa(id)]; !ok {
+					return fmt.Errorf("mode %q has no state for light %d", m.Name, id)
+				}
+			}
+		}
+	case modeKindDance:
+		if len(m.DanceGroups) == 0 {
+			return fmt.Errorf("dance mode %q needs dance_groups", m.Name)
+		}
+		if m.DanceStyle != nil {
+			if err := m.DanceStyle.validate(m.DanceGroups); err != nil {
+				return fmt.Errorf("mode %q: %w", m.Name, err)
+			}
+		}
+	case modeKindEffect:
+		if len(m.Lights) == 0 && len(m.Groups) == 0 {
+			return fmt.Errorf("effect mode %q needs lights or groups", m.Name)
+		}
+		if m.Effect == nil {
+			return fmt.Errorf("effect mode %q needs an effect", m.Name)
+		}
+		if err := m.Effect.validate(); err != nil {
+			return fmt.Errorf("mode %q: %w", m.Name, err)
+		}
+	case modeKindRoutine:
+		if len(m.Lights) == 0 && len(m.Groups) == 0 {
+			return fmt.Errorf("routine mode %q needs lights or groups", m.Name)
+		}
+		if m.Routine == nil {
+			return fmt.Errorf("routine mode %q needs a routine", m.Name)
+		}
+		if err := m.Routine.validate(); err != nil {
+			return fmt.Errorf("mode %q: %w", m.Name, err)
+		}
+	case modeKindCircadian:
+		if len(m.Lights) == 0 && len(m.Groups) == 0 {
+			return fmt.Errorf("circadian mode %q needs lights or groups", m.Name)
+		}
+		if m.Circadian == nil {
+			return fmt.Errorf("circadian mode %q needs a circadian config", m.Name)
+		}
+		if err := m.Circadian.validate(); err != nil {
+			return fmt.Errorf("mode %q: %w", m.Name, err)
+		}
+	default:
+		return fmt.Errorf("mode %q has unknown type %q", m.Name, m.Type)
+	}
+
+	if m.State != nil {
+		if err := m.State.validate(); err != nil {
+			return fmt.Errorf("mode %q: %w", m.Name, err)
+		}
+	}
+	if m.Limits != nil {
+		if err := m.Limits.validate(); err != nil {
+			return fmt.Errorf("mode %q: %w", m.Name, err)
+		}
+	}
+	for id, st := range m.LightStates {
+		if _, err := strconv.Atoi(id); err != nil {
+			return fmt.Errorf("mode %q: light_states keys must be light IDs, got %q", m.Name, id)
+		}
+		if err := st.validate(); err != nil {
+			return fmt.Errorf("mode %q light %s: %w", m.Name, id, err)
+		}
+	}
+	return nil
+}
+
+// lightMode is a resolved mode definition used at runtime.
+type lightMode struct {
+	name        string
+	kind        string
+	lights      []int
+	groups      []int
+	state       *ModeLightState
+	lightStates map[int]*ModeLightState
+	dance       map[string][]int
+	danceStyle  *DanceStyle
+	effect      *EffectConfig
+	routine     *RoutineConfig
+	circadian   *CircadianConfig
+	limits      *LightLimits
+}
+
+// stateFor returns the state a light should be put in by this mode.
+func (m *lightMode) stateFor(id int) *ModeLightState {
+	if st, ok := m.lightStates[id]; ok {
+		return st
+	}
+	return m.state
+}
+
+func newLightMode(cfg ModeConfig) *lightMode {
+	m := &lightMode{
+		name:        cfg.Name,
+		kind:        cfg.Type,
+		lights:      cfg.Lights,
+		groups:      cfg.Groups,
+		state:       cfg.State,
+		lightStates: make(map[int]*ModeLightState, len(cfg.LightStates)),
+		dance:       cfg.DanceGroups,
+		danceStyle:  cfg.DanceStyle,
+		effect:      cfg.Effect,
+		routine:     cfg.Routine,
+		circadian:   cfg.Circadian,
+		limits:      cfg.Limits,
+	}
+	if m.kind == "" {
+		m.kind = modeKindState
+	}
+	for k, st := range cfg.LightStates {
+		id, _ := strconv.Atoi(k)
+		m.lightStates[id] = st
+	}
+	return m
+}
+
+func boolPtr(b bool) *bool          { return &b }
+func floatPtr(f float64) *float64   { return &f }
+func briPercent(bri uint8) *float64 { return floatPtr(float64(bri) / 254 * 100) }
+
+// legacyModes builds the original fixed dance, daylight and warm modes from
+// the top-level config keys, used when no "modes" list is configured.
+func legacyModes(cfg *LightModeConfig) []*lightMode {
+	return []*lightMode{
+		{name: "dance", kind: modeKindDance, dance: cfg.Dance, danceStyle: cfg.DanceStyle},
+		{
+			// Cool daylight white (~6500 K, 153 mireds) at full brightness.
+			name: "daylight", kind: modeKindState, lights: cfg.Daylight,
+			state: &ModeLightState{On: boolPtr(true), Brightness: briPercent(254), Ct: 153, Effect: "none"},
+		},
+		{
+			// Warm incandescent white (~2700 K, 370 mireds) at moderate brightness.
+			name: "warm", kind: modeKindState, lights: cfg.Warm,
+			state: &ModeLightState{On: boolPtr(true), Brightness: briPercent(200), Ct: 370, Effect: "none"},
+		},
+	}
+}
+
+// buildModes returns the runtime modes for a config, in position order
+// starting at position 1 (position 0 is always "none").
+func buildModes(cfg *LightModeConfig) []*lightMode {
+	if len(cfg.Modes) == 0 {
+		return legacyModes(cfg)
+	}
+	modes := make([]*lightMode, len(cfg.Modes))
+	for i, mc := range cfg.Modes {
+		modes[i] = newLightMode(mc)
+	}
+	return modes
+}
+
+// resolveLights returns the deduplicated, sorted light IDs a mode touches,
+// expanding bridge groups to their member lights.
+func (m *lightMode) resolveLights(ctx context.Context, bridge *huego.Bridge) ([]int, error) {
+	if m.kind == modeKindDance {
+		return flattenDanceGroups(m.dance), nil
+	}
+
+	seen := map[int]bool{}
+	for _, id := range m.lights {
+		seen[id] = true
+	}
+	for id := range m.lightStates {
+		seen[id] = true
+	}
+	for _, gid := range m.groups {
+		group, err := bridge.GetGroupContext(ctx, gid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get group %d for mode %q: %w", gid, m.name, err)
+		}
+		for _, l := range group.Lights {
+			id, err := strconv.Atoi(l)
+			if err != nil {
+				return nil, fmt.Errorf("group %d has invalid light id %q", gid, l)
+			}
+			seen[id] = true
+		}
+	}
+
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
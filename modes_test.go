@@ -0,0 +1,135 @@
+package hue
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func TestModeConfigValidate(t *testing.T) {
+	state := &ModeLightState{Ct: 300}
+	tests := []struct {
+		name    string
+		mode    ModeConfig
+		wantErr string
+	}{
+		{"state", ModeConfig{Name: "read", Lights: []int{1}, State: state}, ""},
+		{"light states only", ModeConfig{Name: "read", LightStates: map[string]*ModeLightState{"1": state}}, ""},
+		{"no name", ModeConfig{Lights: []int{1}, State: state}, "needs a name"},
+		{"reserved name", ModeConfig{Name: "none", Lights: []int{1}, State: state}, "reserved"},
+		{"no lights", ModeConfig{Name: "read", State: state}, "needs lights, groups, or light_states"},
+		{"light without state", ModeConfig{Name: "read", Lights: []int{1, 2}, LightStates: map[string]*ModeLightState{"1": state}}, "no state for light 2"},
+		{"groups without state", ModeConfig{Name: "read", Groups: []int{1}}, "needs a state"},
+		{"bad light key", ModeConfig{Name: "read", Lights: []int{1}, State: state, LightStates: map[string]*ModeLightState{"lamp": state}}, "keys must be light IDs"},
+		{"bad light state", ModeConfig{Name: "read", Lights: []int{1}, State: state, LightStates: map[string]*ModeLightState{"1": {Ct: 100}}}, "light 1: ct must be"},
+		{"dance without groups", ModeConfig{Name: "party", Type: modeKindDance}, "needs dance_groups"},
+		{"effect without effect", ModeConfig{Name: "fire", Type: modeKindEffect, Lights: []int{1}}, "needs an effect"},
+		{"routine without routine", ModeConfig{Name: "wake", Type: modeKindRoutine, Lights: []int{1}}, "needs a routine"},
+		{"circadian without lights", ModeConfig{Name: "day", Type: modeKindCircadian}, "needs lights or groups"},
+		{"unknown type", ModeConfig{Name: "x", Type: "disco", Lights: []int{1}}, "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.mode.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModeLightStateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   ModeLightState
+		wantErr string
+	}{
+		{"empty", ModeLightState{}, ""},
+		{"full", ModeLightState{Brightness: floatPtr(50), Hex: "#ff8800", Effect: "none"}, ""},
+		{"brightness", ModeLightState{Brightness: floatPtr(0)}, "brightness must be 1-100"},
+		{"ct", ModeLightState{Ct: 600}, "ct must be 153-500"},
+		{"xy", ModeLightState{Xy: []float64{0.3}}, "xy must be two values"},
+		{"rgb", ModeLightState{RGB: []int{0, 0, 300}}, "rgb values must be 0-255"},
+		{"two colors", ModeLightState{Ct: 300, Hex: "#ffffff"}, "only one of"},
+		{"effect", ModeLightState{Effect: "strobe"}, "effect must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.state.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModeLightStateHueState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state ModeLightState
+		want  huego.State
+	}{
+		{"defaults on", ModeLightState{Ct: 300}, huego.State{On: true, Ct: 300}},
+		{"off drops the rest", ModeLightState{On: boolPtr(false), Ct: 300}, huego.State{On: false}},
+		{"brightness", ModeLightState{Brightness: floatPtr(50)}, huego.State{On: true, Bri: 127}},
+		{"lowest brightness", ModeLightState{Brightness: floatPtr(0.1)}, huego.State{On: true, Bri: 1}},
+		{"xy", ModeLightState{Xy: []float64{0.5, 0.25}}, huego.State{On: true, Xy: []float32{0.5, 0.25}}},
+		{"effect", ModeLightState{Effect: "colorloop"}, huego.State{On: true, Effect: "colorloop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.hueState(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hueState = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLights(t *testing.T) {
+	f := newFakeBridge(t)
+	f.groups[4] = map[string]interface{}{"name": "Kitchen", "type": "Room", "lights": []interface{}{"3", "1"}}
+	f.groups[5] = map[string]interface{}{"name": "Broken", "type": "Room", "lights": []interface{}{"lamp"}}
+	tests := []struct {
+		name    string
+		mode    *lightMode
+		want    []int
+		wantErr bool
+	}{
+		{"lights and groups", newLightMode(ModeConfig{Name: "m", Lights: []int{5, 1}, Groups: []int{4}}), []int{1, 3, 5}, false},
+		{"light states", newLightMode(ModeConfig{Name: "m", LightStates: map[string]*ModeLightState{"7": {}}}), []int{7}, false},
+		{"dance", newLightMode(ModeConfig{Name: "m", Type: modeKindDance, DanceGroups: map[string][]int{"a": {2}, "b": {1}}}), []int{2, 1}, false},
+		{"bad group light", newLightMode(ModeConfig{Name: "m", Groups: []int{5}}), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mode.resolveLights(context.Background(), f.Bridge)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveLights = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveLights = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
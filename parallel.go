@@ -0,0 +1,92 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxParallelLights bounds how many lights are updated at once. The shared
+// bridge rate limiter still caps the overall command rate.
+const maxParallelLights = 5
+
+// lightErrors holds the error for each light that failed in a multi-light
+// operation.
+type lightErrors map[int]error
+
+func (le lightErrors) ids() []int {
+	ids := make([]int, 0, len(le))
+	for id := range le {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (le lightErrors) Error() string {
+	ids := le.ids()
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("light %d: %v", id, le[id])
+	}
+	return fmt.Sprintf("%d light(s) failed: %s", len(ids), strings.Join(parts, "; "))
+}
+
+// toMap describes the failures for DoCommand results, keyed by light ID.
+func (le lightErrors) toMap() map[string]interface{} {
+	out := make(map[string]interface{}, len(le))
+	for id, err := range le {
+		out[fmt.Sprint(id)] = err.Error()
+	}
+	return out
+}
+
+// activationError is returned when a mode failed on some of its lights and
+// the lights it had changed were rolled back.
+type activationError struct {
+	mode           string
+	failed         lightErrors
+	rollbackFailed lightErrors // lights that could not be put back, if any
+}
+
+func (e *activationError) Error() string {
+	msg := fmt.Sprintf("mode %q failed on lights %v and was rolled back: %v", e.mode, e.failed.ids(), e.failed)
+	if e.rollbackFailed != nil {
+		msg += fmt.Sprintf("; rollback failed on lights %v: %v", e.rollbackFailed.ids(), e.rollbackFailed)
+	}
+	return msg
+}
+
+func (e *activationError) Unwrap() error { return e.failed }
+
+// forEachLight calls fn for every light, at most maxParallelLights at a time,
+// and returns the errors by light ID, or nil if every call succeeded. Calls
+// for one light stay in order inside fn, so multi-step updates still work.
+func forEachLight(ctx context.Context, ids []int, fn func(ctx context.Context, id int) error) lightErrors {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = lightErrors{}
+		sem  = make(chan struct{}, maxParallelLights)
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, id); err != nil {
+				mu.Lock()
+				errs[id] = err
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,99 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachLight(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int
+		failing map[int]bool
+		want    []int // IDs of failed lights
+	}{
+		{"no lights", nil, nil, nil},
+		{"all succeed", []int{1, 2, 3}, nil, nil},
+		{"some fail", []int{1, 2, 3, 4}, map[int]bool{2: true, 4: true}, []int{2, 4}},
+		{"more than the limit", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, map[int]bool{12: true}, []int{12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu            sync.Mutex
+				calls         = map[int]int{}
+				running, peak int
+			)
+			errs := forEachLight(context.Background(), tt.ids, func(ctx context.Context, id int) error {
+				mu.Lock()
+				calls[id]++
+				running++
+				peak = max(peak, running)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				if tt.failing[id] {
+					return errors.New("unreachable")
+				}
+				return nil
+			})
+			if len(calls) != len(tt.ids) {
+				t.Errorf("called fn for %d lights, want %d", len(calls), len(tt.ids))
+			}
+			if peak > maxParallelLights {
+				t.Errorf("%d lights ran at once, want at most %d", peak, maxParallelLights)
+			}
+			if tt.want == nil {
+				if errs != nil {
+					t.Errorf("forEachLight = %v, want nil", errs)
+				}
+				return
+			}
+			if !reflect.DeepEqual(errs.ids(), tt.want) {
+				t.Errorf("failed lights = %v, want %v", errs.ids(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLightErrors(t *testing.T) {
+	errs := lightErrors{3: errors.New("off"), 1: errors.New("gone")}
+	if got, want := errs.Error(), "2 light(s) failed: light 1: gone; light 3: off"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got := errs.toMap(); !reflect.DeepEqual(got, map[string]interface{}{"1": "gone", "3": "off"}) {
+		t.Errorf("toMap() = %v", got)
+	}
+
+}
+
+func TestActivationError(t *testing.T) {
+	failed := lightErrors{3: errors.New("off")}
+	tests := []struct {
+		name string
+		err  *activationError
+		want string
+	}{
+		{"rolled back", &activationError{mode: "warm", failed: failed},
+			`mode "warm" failed on lights [3] and was rolled back: 1 light(s) failed: light 3: off`},
+		{"rollback failed", &activationError{mode: "warm", failed: failed, rollbackFailed: lightErrors{1: errors.New("gone")}},
+			`mode "warm" failed on lights [3] and was rolled back: 1 light(s) failed: light 3: off; rollback failed on lights [1]: 1 light(s) failed: light 1: gone`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+			var le lightErrors
+			if !errors.As(tt.err, &le) || le[3] == nil {
+				t.Error("activationError does not unwrap to the failed lights")
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// ReconcileConfig turns on re-applying the state a component last commanded
+// when a light comes back after a power cut or bridge reboot, or is changed
+// from elsewhere.
+type ReconcileConfig struct {
+	IntervalS float64 `json:"interval_s,omitempty"` // how often lights are read, default 5
+	GraceS    float64 `json:"grace_s,omitempty"`    // how long a manual change is left alone, default 300
+}
+
+const (
+	defaultReconcileInterval = 5 * time.Second
+	defaultReconcileGrace    = 5 * time.Minute
+	minReconcileIntervalS    = 1
+)
+
+func (cfg *ReconcileConfig) validate() error {
+	if cfg.IntervalS != 0 && cfg.IntervalS < minReconcileIntervalS {
+		return fmt.Errorf("reconcile interval_s must be at least %d, got %v", minReconcileIntervalS, cfg.IntervalS)
+	}
+	if cfg.GraceS < 0 {
+		return fmt.Errorf("reconcile grace_s must be positive, got %v", cfg.GraceS)
+	}
+	return nil
+}
+
+// desiredState is the state last commanded for a light, merged across every
+// component reconciling it, so the brightness and color switches of a bulb
+// put back one state instead of each reverting the other's changes.
+type desiredState struct {
+	state    huego.State
+	settleAt time.Time   // the light is not compared before its fade is done
+	owner    *reconciler // the component that commanded last re-applies it
+}
+
+var (
+	desiredMu sync.Mutex
+	desired   = map[string]desiredState{} // bridge/light ID -> desired state
+)
+
+// reconciler watches the lights a component controls and re-applies their
+// desired state. A light that was unreachable, or all lights after the bridge
+// itself was unreachable, get it back right away; a light changed while
+// reachable is treated as a manual override and gets it back once the grace
+// window has passed. A nil reconciler ignores every call.
+type reconciler struct {
+	bridge   *huego.Bridge
+	logger   logging.Logger
+	interval time.Duration
+	grace    time.Duration
+
+	// apply re-applies the desired state to lights; setLightState by default.
+	apply func(ctx context.Context, ids []int) error
+	claim *claimant // lights another owner has taken are left alone
+
+	lights map[int]bool // lights this component has commanded, guarded by desiredMu
+
+	// only touched by the run goroutine
+	reachable  map[int]bool
+	driftSince map[int]time.Time
+	bridgeDown bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newReconciler starts a reconciler, or returns nil when cfg is nil.
+// apply may be nil to set each light to its desired state.
+func newReconciler(cfg *ReconcileConfig, bridge *huego.Bridge, claim *claimant, logger logging.Logger, apply func(ctx context.Context, ids []int) error) *reconciler {
+	if cfg == nil {
+		return nil
+	}
+	r := &reconciler{
+		bridge:     bridge,
+		logger:     logger,
+		interval:   defaultReconcileInterval,
+		grace:      defaultReconcileGrace,
+		apply:      apply,
+		claim:      claim,
+		lights:     map[int]bool{},
+		reachable:  map[int]bool{},
+		driftSince: map[int]time.Time{},
+		done:       make(chan struct{}),
+	}
+	if cfg.IntervalS > 0 {
+		r.interval = time.Duration(cfg.IntervalS * float64(time.Second))
+	}
+	if cfg.GraceS > 0 {
+		r.grace = time.Duration(cfg.GraceS * float64(time.Second))
+	}
+	if r.apply == nil {
+		r.apply = r.applyDesired
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	ctx = withClaimant(ctx, claim)
+	go func() {
+		defer close(r.done)
+		for sleepCtx(ctx, r.interval) == nil {
+			r.check(ctx)
+		}
+	}()
+	return r
+}
+
+// set merges the state just commanded for a light, sent with the given fade,
+// into its desired state and makes r the one to re-apply it.
+func (r *reconciler) set(id int, state huego.State, fadeMs int) {
+	r.record(id, state, fadeMs, true)
+}
+
+// replace makes a whole state just commanded for a light, such as a mode's,
+// its desired state, dropping fields other components set before.
+func (r *reconciler) replace(id int, state huego.State, fadeMs int) {
+	r.record(id, state, fadeMs, false)
+}
+
+func (r *reconciler) record(id int, state huego.State, fadeMs int, merge bool) {
+	if r == nil {
+		return
+	}
+	if fadeMs < 0 {
+		fadeMs = 400 // bridge default
+	}
+	state = limitedState(r.bridge, id, state)
+	key := commandedKey(r.bridge, id)
+	desiredMu.Lock()
+	defer desiredMu.Unlock()
+	if merge {
+		state = mergeState(desired[key].state, state)
+	}
+	desired[key] = desiredState{
+		state:    state,
+		settleAt: time.Now().Add(time.Duration(fadeMs)*time.Millisecond + driftSettle),
+		owner:    r,
+	}
+	r.lights[id] = true
+}
+
+// clear forgets the desired state of every light r commanded last, since it
+// no longer stands; lights another component commanded since keep theirs.
+func (r *reconciler) clear() {
+	if r == nil {
+		return
+	}
+	desiredMu.Lock()
+	defer desiredMu.Unlock()
+	for id := range r.lights {
+		key := commandedKey(r.bridge, id)
+		if desired[key].owner == r {
+			delete(desired, key)
+		}
+	}
+	r.lights = map[int]bool{}
+}
+
+func (r *reconciler) close() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	r.clear()
+}
+
+// owned returns the desired state of the lights r re-applies.
+func (r *reconciler) owned() map[int]desiredState {
+	desiredMu.Lock()
+	defer desiredMu.Unlock()
+	out := map[int]desiredState{}
+	for id := range r.lights {
+		if d := desired[commandedKey(r.bridge, id)]; d.owner == r {
+			out[id] = d
+		}
+	}
+	return out
+}
+
+// check reads the lights once and re-applies the desired state where due.
+func (r *reconciler) check(ctx context.Context) {
+	desired := r.owned()
+	if len(desired) == 0 {
+		return
+	}
+
+	lights, err := r.bridge.GetLightsContext(ctx)
+	if err != nil {
+		if !r.bridgeDown && ctx.Err() == nil {
+			r.logger.Infof("reconcile: bridge unreachable: %v", err)
+		}
+		r.bridgeDown = true
+		return
+	}
+	bridgeBack := r.bridgeDown
+	r.bridgeDown = false
+	states := make(map[int]*huego.State, len(lights))
+	for i := range lights {
+		states[lights[i].ID] = lights[i].State
+	}
+
+	now := time.Now()
+	var due []int
+	for id, d := range desired {
+		got := states[id]
+		if got == nil || !got.Reachable {
+			r.reachable[id] = false
+			delete(r.driftSince, id)
+			continue
+		}
+		wasReachable, known := r.reachable[id]
+		r.reachable[id] = true
+		if now.Before(d.settleAt) || !stateDrifted(d.state, got) || r.claim.check(r.bridge, id) != nil {
+			delete(r.driftSince, id)
+			continue
+		}
+		if bridgeBack || (known && !wasReachable) {
+			r.logger.Infof("reconcile: light %d came back in a different state, re-applying", id)
+			due = append(due, id)
+			continue
+		}
+		since, ok := r.driftSince[id]
+		if !ok {
+			since = now
+			r.driftSince[id] = now
+			r.logger.Infof("reconcile: light %d was changed elsewhere, re-applying in %v", id, r.grace)
+		}
+		if now.Sub(since) >= r.grace {
+			due = append(due, id)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	if err := r.apply(ctx, due); err != nil {
+		if ctx.Err() == nil {
+			r.logger.Debugf("reconcile: failed to re-apply lights %v: %v", due, err)
+		}
+		return
+	}
+	for _, id := range due {
+		delete(r.driftSince, id)
+	}
+}
+
+// applyDesired sets each light back to its desired state.
+func (r *reconciler) applyDesired(ctx context.Context, ids []int) error {
+	desired := r.owned()
+	if errs := forEachLight(ctx, ids, func(ctx context.Context, id int) error {
+		d, ok := desired[id]
+		if !ok {
+			return nil // changed or cleared since the check
+		}
+		st := d.state
+		st.ColorMode = "" // read-only on the bridge
+		return setLightState(ctx, r.bridge, id, st, transitionDefault)
+	}); errs != nil {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package hue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+func TestReconcilerCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		unreach   bool // the light drops off before it drifts
+		grace     float64
+		held      bool // a higher-priority owner holds the light
+		reapplied bool
+	}{
+		{"came back", true, 3600, false, true},
+		{"changed within grace", false, 3600, false, false},
+		{"changed past grace", false, 0.001, false, true},
+		{"held by another owner", false, 0.001, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, map[string]interface{}{"on": true, "bri": 100})
+			logger := logging.NewTestLogger(t)
+			claim := newClaimant("brightness", nil, priorityManual, defaultManualHold, logger)
+			defer claim.close(f.Bridge)
+			r := newReconciler(&ReconcileConfig{IntervalS: 3600, GraceS: tt.grace}, f.Bridge, claim, logger, nil)
+			defer r.close()
+			ctx := withClaimant(context.Background(), claim)
+
+			r.set(1, huego.State{On: true, Bri: 100}, 0)
+			r.check(ctx) // settling
+			if tt.unreach {
+				f.addLight(1, map[string]interface{}{"on": true, "bri": 100, "reachable": false})
+				time.Sleep(driftSettle)
+				r.check(ctx)
+			} else {
+				time.Sleep(driftSettle)
+			}
+			f.addLight(1, map[string]interface{}{"on": true, "bri": 20})
+			if tt.held {
+				mode := newClaimant("mode", nil, priorityMode, 0, logger)
+				defer mode.close(f.Bridge)
+				if err := mode.claim(f.Bridge, []int{1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.check(ctx)
+			time.Sleep(10 * time.Millisecond)
+			r.check(ctx)
+
+			reapplied := f.state(1)["bri"] == 100.0
+			if reapplied != tt.reapplied {
+				t.Errorf("re-applied = %v, want %v", reapplied, tt.reapplied)
+			}
+		})
+	}
+}
+
+func TestReconcilersShareDesiredState(t *testing.T) {
+	f := newFakeBridge(t)
+	f.addLight(1, map[string]interface{}{"on": true, "bri": 100})
+	logger := logging.NewTestLogger(t)
+	cfg := &ReconcileConfig{IntervalS: 3600, GraceS: 0.001}
+	brightness := newReconciler(cfg, f.Bridge, nil, logger, nil)
+	defer brightness.close()
+	color := newReconciler(cfg, f.Bridge, nil, logger, nil)
+	defer color.close()
+
+	brightness.set(1, huego.State{On: true, Bri: 100}, 0)
+	color.set(1, huego.State{On: true, Xy: []float32{0.6, 0.3}}, 0)
+	time.Sleep(driftSettle)
+
+	// the light is changed elsewhere; only the component that commanded
+	// last puts it back, and with both components' changes
+	f.addLight(1, map[string]interface{}{"on": true, "bri": 20, "xy": []interface{}{0.2, 0.2}})
+	for i := 0; i < 2; i++ {
+		brightness.check(context.Background())
+		color.check(context.Background())
+		time.Sleep(10 * time.Millisecond)
+	}
+	writes := f.writes("/lights/1/state")
+	if len(writes) != 1 {
+		t.Fatalf("%d re-applies, want 1", len(writes))
+	}
+	if body := writes[0].body; body["bri"] != 100.0 || body["xy"] == nil {
+		t.Errorf("re-applied %v, want the brightness and the color", body)
+	}
+
+	// a component that stops reconciling drops only what it commanded last
+	color.clear()
+	if len(brightness.owned()) != 0 {
+		t.Error("brightness owns the light after color cleared its state")
+	}
+	brightness.set(1, huego.State{On: false}, 0)
+	color.clear()
+	if len(brightness.owned()) != 1 {
+		t.Error("color cleared a state brightness commanded last")
+	}
+}
@@ -0,0 +1,252 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// RoutineConfig describes a gradual multi-minute ramp of brightness and color
+// temperature, such as a sunrise wake-up or a sunset wind-down.
+type RoutineConfig struct {
+	Type            string  `json:"type"`                       // "sunrise" or "sunset"
+	Lights          []int   `json:"lights,omitempty"`           // only used by start_routine; modes use their own lights
+	DurationMin     float64 `json:"duration_min,omitempty"`     // default 30
+	StartBrightness float64 `json:"start_brightness,omitempty"` // percent
+	EndBrightness   float64 `json:"end_brightness,omitempty"`   // percent
+	StartCt         uint16  `json:"start_ct,omitempty"`         // mireds
+	EndCt           uint16  `json:"end_ct,omitempty"`           // mireds
+	Color           bool    `json:"color,omitempty"`            // pass through deep red and orange at the dim end
+	StepS           float64 `json:"step_s,omitempty"`           // seconds between updates, default 10
+	TurnOff         *bool   `json:"turn_off,omitempty"`         // turn lights off at the end; default true for sunset
+}
+
+// routineDefaults holds the ramp used for each routine type when the config
+// leaves a field out.
+var routineDefaults = map[string]struct {
+	startBri, endBri float64
+	startCt, endCt   uint16
+	turnOff          bool
+}{
+	"sunrise": {startBri: 1, endBri: 100, startCt: 500, endCt: 250},
+	"sunset":  {startBri: 100, endBri: 1, startCt: 250, endCt: 500, turnOff: true},
+}
+
+const (
+	defaultRoutineMinutes = 30
+	defaultRoutineStep    = 10 * time.Second
+	minRoutineStep        = time.Second
+
+	// routineColorPhase is the fraction of a color routine spent on the xy
+	// path, at the start of a sunrise and the end of a sunset.
+	routineColorPhase = 0.4
+)
+
+// sunColorPath runs from the deepest red through orange to a warm white.
+var sunColorPath = [][2]float64{{0.675, 0.322}, {0.600, 0.380}, {0.520, 0.413}}
+
+func (cfg *RoutineConfig) validate() error {
+	if _, ok := routineDefaults[cfg.Type]; !ok {
+		return fmt.Errorf("routine type must be \"sunrise\" or \"sunset\", got %q", cfg.Type)
+	}
+	if cfg.DurationMin < 0 {
+		return fmt.Errorf("duration_min must be positive, got %v", cfg.DurationMin)
+	}
+	for _, b := range []float64{cfg.StartBrightness, cfg.EndBrightness} {
+		if b < 0 || b > 100 {
+			return fmt.Errorf("routine brightness must be 1-100, got %v", b)
+		}
+	}
+	for _, ct := range []uint16{cfg.StartCt, cfg.EndCt} {
+		if ct != 0 && (ct < 153 || ct > 500) {
+			return fmt.Errorf("routine ct must be 153-500 mireds, got %d", ct)
+		}
+	}
+	if cfg.StepS < 0 {
+		return fmt.Errorf("step_s must be positive, got %v", cfg.StepS)
+	}
+	return nil
+}
+
+// routine is a compiled RoutineConfig bound to a set of lights. It records its
+// progress so status can report it while the ramp runs.
+type routine struct {
+	kind             string
+	lights           []int
+	duration         time.Duration
+	step             time.Duration
+	startBri, endBri float64
+	startCt, endCt   float64
+	color            bool
+	turnOff          bool
+
+	mu       sync.Mutex
+	started  time.Time
+	progress float64
+	finished bool
+}
+
+func newRoutine(cfg *RoutineConfig, lights []int) (*routine, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(lights) == 0 {
+		return nil, fmt.Errorf("routine %q needs at least one light", cfg.Type)
+	}
+
+	d := routineDefaults[cfg.Type]
+	r := &routine{
+		kind:     cfg.Type,
+		lights:   lights,
+		duration: time.Duration(cfg.DurationMin * float64(time.Minute)),
+		step:     time.Duration(cfg.StepS * float64(time.Second)),
+		startBri: d.startBri,
+		endBri:   d.endBri,
+		startCt:  float64(d.startCt),
+		endCt:    float64(d.endCt),
+		color:    cfg.Color,
+		turnOff:  d.turnOff,
+	}
+	if r.duration == 0 {
+		r.duration = defaultRoutineMinutes * time.Minute
+	}
+	if r.step == 0 {
+		r.step = defaultRoutineStep
+	}
+	r.step = max(r.step, minRoutineStep)
+	if cfg.StartBrightness > 0 {
+		r.startBri = cfg.StartBrightness
+	}
+	if cfg.EndBrightness > 0 {
+		r.endBri = cfg.EndBrightness
+	}
+	if cfg.StartCt > 0 {
+		r.startCt = float64(cfg.StartCt)
+	}
+	if cfg.EndCt > 0 {
+		r.endCt = float64(cfg.EndCt)
+	}
+	if cfg.TurnOff != nil {
+		r.turnOff = *cfg.TurnOff
+	}
+	return r, nil
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// colorPathAt returns the xy point at fraction t along sunColorPath.
+func colorPathAt(t float64) []float32 {
+	segments := float64(len(sunColorPath) - 1)
+	pos := math.Min(t, 1) * segments
+	i := min(int(pos), len(sunColorPath)-2)
+	f := pos - float64(i)
+	a, b := sunColorPath[i], sunColorPath[i+1]
+	return []float32{float32(lerp(a[0], b[0], f)), float32(lerp(a[1], b[1], f))}
+}
+
+// stateAt returns the light state at progress p (0-1) through the routine.
+func (r *routine) stateAt(p float64) huego.State {
+	state := huego.State{On: true, Bri: percentToBri(lerp(r.startBri, r.endBri, p))}
+
+	if !r.color {
+		state.Ct = uint16(math.Round(lerp(r.startCt, r.endCt, p)))
+		return state
+	}
+
+	// Sunrise starts on the red-to-white path and then warms up through ct;
+	// sunset mirrors it, ending on the path from white back to red.
+	switch {
+	case r.kind == "sunrise" && p < routineColorPhase:
+		state.Xy = colorPathAt(p / routineColorPhase)
+	case r.kind == "sunrise":
+		state.Ct = uint16(math.Round(lerp(r.startCt, r.endCt, (p-routineColorPhase)/(1-routineColorPhase))))
+	case p > 1-routineColorPhase:
+		state.Xy = colorPathAt(1 - (p-(1-routineColorPhase))/routineColorPhase)
+	default:
+		state.Ct = uint16(math.Round(lerp(r.startCt, r.endCt, p/(1-routineColorPhase))))
+	}
+	return state
+}
+
+func (r *routine) category() string       { return "routine" }
+func (r *routine) name() string           { return r.kind }
+func (r *routine) lightIDs() []int        { return r.lights }
+func (r *routine) timeout() time.Duration { return 0 }
+
+func (r *routine) status() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Duration(0)
+	if !r.started.IsZero() {
+		elapsed = min(time.Since(r.started), r.duration)
+	}
+	return map[string]interface{}{
+		"progress":    r.progress,
+		"elapsed_s":   elapsed.Seconds(),
+		"remaining_s": (r.duration - elapsed).Seconds(),
+		"finished":    r.finished,
+	}
+}
+
+func (r *routine) setProgress(p float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress = p
+}
+
+// run puts the lights at the starting state, then every step fades them to
+// where the ramp will be one step later, so the change looks continuous.
+func (r *routine) run(ctx context.Context, bridge *huego.Bridge, logger logging.Logger) {
+	r.mu.Lock()
+	r.started = time.Now()
+	r.mu.Unlock()
+
+	apply := func(state huego.State, transitionMs int) bool {
+		for _, id := range r.lights {
+			if err := setLightState(ctx, bridge, id, state, transitionMs); err != nil {
+				if ctx.Err() != nil {
+					return false
+				}
+				logger.Debugf("%s: failed to update light %d: %v", r.kind, id, err)
+			}
+		}
+		return true
+	}
+
+	first := r.stateAt(0)
+	first.Effect = "none"
+	if !apply(first, 0) {
+		return
+	}
+
+	for {
+		elapsed := time.Since(r.started)
+		r.setProgress(math.Min(1, float64(elapsed)/float64(r.duration)))
+
+		stepEnd := min(elapsed+r.step, r.duration)
+		fade := stepEnd - elapsed
+		if fade <= 0 {
+			break
+		}
+		if !apply(r.stateAt(float64(stepEnd)/float64(r.duration)), int(fade/time.Millisecond)) {
+			return
+		}
+		if sleepCtx(ctx, fade) != nil {
+			return
+		}
+	}
+
+	if r.turnOff {
+		apply(huego.State{On: false}, transitionDefault)
+	}
+	r.mu.Lock()
+	r.progress, r.finished = 1, true
+	r.mu.Unlock()
+}
@@ -0,0 +1,112 @@
+package hue
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+func TestRoutineValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RoutineConfig
+		wantErr string
+	}{
+		{"sunrise", RoutineConfig{Type: "sunrise"}, ""},
+		{"sunset with ramp", RoutineConfig{Type: "sunset", DurationMin: 10, StartBrightness: 80, EndCt: 454}, ""},
+		{"unknown type", RoutineConfig{Type: "noon"}, "routine type must be"},
+		{"negative duration", RoutineConfig{Type: "sunrise", DurationMin: -1}, "duration_min"},
+		{"brightness", RoutineConfig{Type: "sunrise", EndBrightness: 101}, "brightness must be 1-100"},
+		{"ct", RoutineConfig{Type: "sunrise", StartCt: 600}, "ct must be 153-500"},
+		{"step", RoutineConfig{Type: "sunrise", StepS: -1}, "step_s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoutineStateAt(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RoutineConfig
+		p    float64
+		want huego.State
+	}{
+		{"sunrise start", RoutineConfig{Type: "sunrise"}, 0, huego.State{On: true, Bri: percentToBri(1), Ct: 500}},
+		{"sunrise middle", RoutineConfig{Type: "sunrise"}, 0.5, huego.State{On: true, Bri: percentToBri(50.5), Ct: 375}},
+		{"sunrise end", RoutineConfig{Type: "sunrise"}, 1, huego.State{On: true, Bri: percentToBri(100), Ct: 250}},
+		{"sunset end", RoutineConfig{Type: "sunset"}, 1, huego.State{On: true, Bri: percentToBri(1), Ct: 500}},
+		{"custom ramp", RoutineConfig{Type: "sunset", StartBrightness: 60, EndBrightness: 20, StartCt: 300, EndCt: 400}, 0.5,
+			huego.State{On: true, Bri: percentToBri(40), Ct: 350}},
+		{"color sunrise starts red", RoutineConfig{Type: "sunrise", Color: true}, 0, huego.State{On: true, Bri: percentToBri(1), Xy: []float32{0.675, 0.322}}},
+		{"color sunrise ends white", RoutineConfig{Type: "sunrise", Color: true}, 1, huego.State{On: true, Bri: percentToBri(100), Ct: 250}},
+		{"color sunset starts white", RoutineConfig{Type: "sunset", Color: true}, 0, huego.State{On: true, Bri: percentToBri(100), Ct: 250}},
+		{"color sunset ends red", RoutineConfig{Type: "sunset", Color: true}, 1, huego.State{On: true, Bri: percentToBri(1), Xy: []float32{0.675, 0.322}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRoutine(&tt.cfg, []int{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.stateAt(tt.p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stateAt(%v) = %+v, want %+v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutineRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RoutineConfig
+		wantOff bool
+	}{
+		{"sunrise stays on", RoutineConfig{Type: "sunrise", DurationMin: 0.001}, false},
+		{"sunset turns off", RoutineConfig{Type: "sunset", DurationMin: 0.001}, true},
+		{"sunset kept on", RoutineConfig{Type: "sunset", DurationMin: 0.001, TurnOff: boolPtr(false)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, nil)
+			r, err := newRoutine(&tt.cfg, []int{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			r.run(ctx, f.Bridge, logging.NewTestLogger(t))
+
+			if st := r.status(); st["finished"] != true || st["progress"] != 1.0 {
+				t.Errorf("status = %v, want finished", st)
+			}
+			writes := f.writes("/lights/1/state")
+			if len(writes) < 2 {
+				t.Fatalf("got %d writes, want the start and at least one step", len(writes))
+			}
+			if first := writes[0].body; first["transitiontime"] != 0.0 || first["effect"] != "none" {
+				t.Errorf("first write %v, want an instant start with effect none", first)
+			}
+			if on := f.state(1)["on"]; on == tt.wantOff {
+				t.Errorf("light on = %v at the end, want %v", on, !tt.wantOff)
+			}
+		})
+	}
+}
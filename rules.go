@@ -0,0 +1,617 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// Bridge rules let sensor and button events trigger actions on the bridge
+// without a round trip through the robot. Rules and CLIP sensors (virtual
+// sensors that rules can read and write) are managed through DoCommand on
+// hue-discovery:
+//
+//	{"list_rules": true}
+//	{"create_rule": {"name": ..., "conditions": [...], "actions": [...]}}
+//	{"update_rule": {"id": 2, ...}}
+//	{"delete_rule": 2}
+//	{"list_sensors": true} or {"list_sensors": {"clip_only": true}}
+//	{"create_sensor": {"name": ..., "type": "CLIPGenericStatus"}}
+//	{"update_sensor": {"id": 9, "name": ..., "state": {...}, "config": {...}}}
+//	{"delete_sensor": 9}
+//
+// Every mutating command accepts "dry_run": true, which validates the request
+// and reports what would change without touching the bridge.
+
+// The bridge rejects rules with more than this many conditions or actions.
+const (
+	maxRuleConditions = 8
+	maxRuleActions    = 8
+)
+
+// ruleOperators maps each condition operator to whether it requires a value.
+var ruleOperators = map[string]bool{
+	"eq": true, "gt": true, "lt": true, "dx": false, "ddx": true,
+	"stable": true, "not stable": true, "in": true, "not in": true,
+}
+
+// bridgeInventory holds the IDs of every addressable bridge resource so rule
+// addresses can be checked before anything is written.
+type bridgeInventory struct {
+	lights    map[int]bool
+	groups    map[int]bool
+	sensors   map[int]bool
+	schedules map[int]bool
+	scenes    map[string]bool
+}
+
+func (s *HueDiscover) loadInventory(ctx context.Context) (*bridgeInventory, error) {
+	inv := &bridgeInventory{
+		lights:    map[int]bool{},
+		groups:    map[int]bool{0: true}, // group 0 is every light and always exists
+		sensors:   map[int]bool{},
+		schedules: map[int]bool{},
+		scenes:    map[string]bool{},
+	}
+
+	lights, err := s.bridge.GetLightsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get lights: %w", err)
+	}
+	for _, l := range lights {
+		inv.lights[l.ID] = true
+	}
+	groups, err := s.bridge.GetGroupsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get groups: %w", err)
+	}
+	for _, g := range groups {
+		inv.groups[g.ID] = true
+	}
+	sensors, err := s.bridge.GetSensorsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get sensors: %w", err)
+	}
+	for _, sn := range sensors {
+		inv.sensors[sn.ID] = true
+	}
+	schedules, err := s.bridge.GetSchedulesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schedules: %w", err)
+	}
+	for _, sc := range schedules {
+		inv.schedules[sc.ID] = true
+	}
+	scenes, err := s.bridge.GetScenesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get scenes: %w", err)
+	}
+	for _, sc := range scenes {
+		inv.scenes[sc.ID] = true
+	}
+	return inv, nil
+}
+
+// normalizeAddress strips an optional /api/<username> prefix, which rules do
+// not use, and splits the remainder into path segments.
+func (s *HueDiscover) normalizeAddress(address string) (string, []string) {
+	address = strings.TrimPrefix(address, "/api/"+s.cfg.Username)
+	return address, strings.Split(strings.Trim(address, "/"), "/")
+}
+
+func (inv *bridgeInventory) checkID(kind, id string) error {
+	if kind == "scenes" {
+		if !inv.scenes[id] {
+			return fmt.Errorf("scene %s does not exist", id)
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid %s id %q", strings.TrimSuffix(kind, "s"), id)
+	}
+	var known map[int]bool
+	switch kind {
+	case "lights":
+		known = inv.lights
+	case "groups":
+		known = inv.groups
+	case "sensors":
+		known = inv.sensors
+	case "schedules":
+		known = inv.schedules
+	default:
+		return fmt.Errorf("unsupported resource type %q", kind)
+	}
+	if !known[n] {
+		return fmt.Errorf("%s %d does not exist", strings.TrimSuffix(kind, "s"), n)
+	}
+	return nil
+}
+
+func (s *HueDiscover) parseCondition(inv *bridgeInventory, v interface{}) (*huego.Condition, error) {
+	m, err := mapArg(v, "condition")
+	if err != nil {
+		return nil, err
+	}
+	address, _ := m["address"].(string)
+	operator, _ := m["operator"].(string)
+
+	address, parts := s.normalizeAddress(address)
+	switch {
+	case address == "/config/localtime":
+		if operator != "in" && operator != "not in" {
+			return nil, fmt.Errorf("/config/localtime only supports the \"in\" and \"not in\" operators")
+		}
+	case len(parts) == 4 && (parts[0] == "sensors" && (parts[2] == "state" || parts[2] == "config") ||
+		parts[0] == "lights" && parts[2] == "state" ||
+		parts[0] == "groups" && parts[2] == "state"):
+		if err := inv.checkID(parts[0], parts[1]); err != nil {
+			return nil, fmt.Errorf("condition %s: %w", address, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported condition address %q", address)
+	}
+
+	needsValue, ok := ruleOperators[operator]
+	if !ok {
+		return nil, fmt.Errorf("unsupported condition operator %q", operator)
+	}
+
+	cond := &huego.Condition{Address: address, Operator: operator}
+	switch val := m["value"].(type) {
+	case nil:
+	case string:
+		cond.Value = val
+	case bool:
+		cond.Value = strconv.FormatBool(val)
+	case float64:
+		cond.Value = strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("condition %s: value must be a string, number or bool", address)
+	}
+	if needsValue && cond.Value == "" {
+		return nil, fmt.Errorf("condition %s: operator %q needs a value", address, operator)
+	}
+	if !needsValue && cond.Value != "" {
+		return nil, fmt.Errorf("condition %s: operator %q takes no value", address, operator)
+	}
+	return cond, nil
+}
+
+func (s *HueDiscover) parseRuleAction(inv *bridgeInventory, v interface{}) (*huego.RuleAction, error) {
+	m, err := mapArg(v, "action")
+	if err != nil {
+		return nil, err
+	}
+	address, _ := m["address"].(string)
+	method, _ := m["method"].(string)
+	if method == "" {
+		method = http.MethodPut
+	}
+	method = strings.ToUpper(method)
+
+	address, parts := s.normalizeAddress(address)
+	valid := false
+	switch {
+	case len(parts) == 3 && parts[0] == "lights" && parts[2] == "state",
+		len(parts) == 3 && parts[0] == "groups" && parts[2] == "action",
+		len(parts) == 3 && parts[0] == "sensors" && (parts[2] == "state" || parts[2] == "config"),
+		len(parts) == 2 && parts[0] == "schedules",
+		len(parts) >= 2 && parts[0] == "scenes":
+		valid = true
+	}
+	if !valid {
+		return nil, fmt.Errorf("unsupported action address %q", address)
+	}
+	if err := inv.checkID(parts[0], parts[1]); err != nil {
+		return nil, fmt.Errorf("action %s: %w", address, err)
+	}
+
+	switch method {
+	case http.MethodPut, http.MethodPost:
+		if _, ok := m["body"].(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("action %s: %s needs an object body", address, method)
+		}
+	case http.MethodDelete:
+	default:
+		return nil, fmt.Errorf("action %s: unsupported method %q", address, method)
+	}
+
+	return &huego.RuleAction{Address: address, Method: method, Body: m["body"]}, nil
+}
+
+// parseRuleSpec builds the rule fields present in spec. Fields absent from
+// spec are left empty so huego's omitempty tags keep them out of updates.
+func (s *HueDiscover) parseRuleSpec(ctx context.Context, spec map[string]interface{}) (*huego.Rule, error) {
+	rule := &huego.Rule{}
+	if v, ok := spec["name"].(string); ok {
+		rule.Name = v
+	}
+	if v, ok := spec["enabled"].(bool); ok {
+		rule.Status = scheduleStatus(v)
+	}
+
+	conditions, hasConditions := spec["conditions"].([]interface{})
+	actions, hasActions := spec["actions"].([]interface{})
+	if !hasConditions && !hasActions {
+		return rule, nil
+	}
+
+	inv, err := s.loadInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hasConditions {
+		if len(conditions) == 0 || len(conditions) > maxRuleConditions {
+			return nil, fmt.Errorf("a rule needs 1-%d conditions, got %d", maxRuleConditions, len(conditions))
+		}
+		for _, c := range conditions {
+			cond, err := s.parseCondition(inv, c)
+			if err != nil {
+				return nil, err
+			}
+			rule.Conditions = append(rule.Conditions, cond)
+		}
+	}
+	if hasActions {
+		if len(actions) == 0 || len(actions) > maxRuleActions {
+			return nil, fmt.Errorf("a rule needs 1-%d actions, got %d", maxRuleActions, len(actions))
+		}
+		for _, a := range actions {
+			action, err := s.parseRuleAction(inv, a)
+			if err != nil {
+				return nil, err
+			}
+			rule.Actions = append(rule.Actions, action)
+		}
+	}
+	return rule, nil
+}
+
+func ruleToMap(rule *huego.Rule) map[string]interface{} {
+	conditions := make([]interface{}, len(rule.Conditions))
+	for i, c := range rule.Conditions {
+		cond := map[string]interface{}{"address": c.Address, "operator": c.Operator}
+		if c.Value != "" {
+			cond["value"] = c.Value
+		}
+		conditions[i] = cond
+	}
+	actions := make([]interface{}, len(rule.Actions))
+	for i, a := range rule.Actions {
+		action := map[string]interface{}{"address": a.Address, "method": a.Method}
+		if a.Body != nil {
+			action["body"] = a.Body
+		}
+		actions[i] = action
+	}
+	out := map[string]interface{}{
+		"id":         rule.ID,
+		"name":       rule.Name,
+		"status":     rule.Status,
+		"conditions": conditions,
+		"actions":    actions,
+	}
+	if rule.LastTriggered != "" {
+		out["lasttriggered"] = rule.LastTriggered
+		out["timestriggered"] = rule.TimesTriggered
+	}
+	return out
+}
+
+func isDryRun(spec map[string]interface{}) bool {
+	dry, _ := spec["dry_run"].(bool)
+	return dry
+}
+
+// idAndDryRun accepts either a bare id or {"id": ..., "dry_run": ...}.
+func idAndDryRun(arg interface{}, command string) (int, bool, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		id, err := intArg(m["id"])
+		if err != nil {
+			return 0, false, fmt.Errorf("%s needs an id: %w", command, err)
+		}
+		return id, isDryRun(m), nil
+	}
+	id, err := intArg(arg)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s needs an id: %w", command, err)
+	}
+	return id, false, nil
+}
+
+func (s *HueDiscover) listRules(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	rules, err := s.bridge.GetRulesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get rules: %w", err)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	out := make([]interface{}, len(rules))
+	for i, r := range rules {
+		out[i] = ruleToMap(r)
+	}
+	return map[string]interface{}{"rules": out}, nil
+}
+
+func (s *HueDiscover) createRule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "create_rule")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := spec["conditions"]; !ok {
+		return nil, fmt.Errorf("create_rule needs conditions")
+	}
+	if _, ok := spec["actions"]; !ok {
+		return nil, fmt.Errorf("create_rule needs actions")
+	}
+	rule, err := s.parseRuleSpec(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if isDryRun(spec) {
+		return map[string]interface{}{"dry_run": true, "create": ruleToMap(rule)}, nil
+	}
+
+	resp, err := s.bridge.CreateRuleContext(ctx, rule)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rule: %w", err)
+	}
+	idStr, _ := resp.Success["id"].(string)
+	if rule.ID, err = strconv.Atoi(idStr); err != nil {
+		return nil, fmt.Errorf("bridge returned unexpected rule id %v", resp.Success["id"])
+	}
+	return map[string]interface{}{"rule": ruleToMap(rule)}, nil
+}
+
+func (s *HueDiscover) updateRule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "update_rule")
+	if err != nil {
+		return nil, err
+	}
+	id, err := intArg(spec["id"])
+	if err != nil {
+		return nil, fmt.Errorf("update_rule needs an id: %w", err)
+	}
+	current, err := s.bridge.GetRuleContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get rule %d: %w", id, err)
+	}
+	current.ID = id
+
+	update, err := s.parseRuleSpec(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	after := *current
+	if update.Name != "" {
+		after.Name = update.Name
+	}
+	if update.Status != "" {
+		after.Status = update.Status
+	}
+	if update.Conditions != nil {
+		after.Conditions = update.Conditions
+	}
+	if update.Actions != nil {
+		after.Actions = update.Actions
+	}
+
+	if isDryRun(spec) {
+		return map[string]interface{}{"dry_run": true, "before": ruleToMap(current), "after": ruleToMap(&after)}, nil
+	}
+
+	if _, err := s.bridge.UpdateRuleContext(ctx, id, update); err != nil {
+		return nil, fmt.Errorf("cannot update rule %d: %w", id, err)
+	}
+	return map[string]interface{}{"rule": ruleToMap(&after)}, nil
+}
+
+func (s *HueDiscover) deleteRule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	id, dryRun, err := idAndDryRun(arg, "delete_rule")
+	if err != nil {
+		return nil, err
+	}
+	rule, err := s.bridge.GetRuleContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get rule %d: %w", id, err)
+	}
+	rule.ID = id
+	if dryRun {
+		return map[string]interface{}{"dry_run": true, "delete": ruleToMap(rule)}, nil
+	}
+	if err := s.bridge.DeleteRuleContext(ctx, id); err != nil {
+		return nil, fmt.Errorf("cannot delete rule %d: %w", id, err)
+	}
+	return map[string]interface{}{"deleted": ruleToMap(rule)}, nil
+}
+
+func isCLIPSensor(sensor *huego.Sensor) bool {
+	return strings.HasPrefix(sensor.Type, "CLIP")
+}
+
+func sensorToMap(sensor *huego.Sensor) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           sensor.ID,
+		"name":         sensor.Name,
+		"type":         sensor.Type,
+		"model_id":     sensor.ModelID,
+		"manufacturer": sensor.ManufacturerName,
+		"unique_id":    sensor.UniqueID,
+		"state":        sensor.State,
+		"config":       sensor.Config,
+		"clip":         isCLIPSensor(sensor),
+	}
+}
+
+func (s *HueDiscover) listSensors(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	clipOnly := false
+	if m, ok := arg.(map[string]interface{}); ok {
+		clipOnly, _ = m["clip_only"].(bool)
+	}
+
+	sensors, err := s.bridge.GetSensorsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get sensors: %w", err)
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].ID < sensors[j].ID })
+
+	out := []interface{}{}
+	for i := range sensors {
+		if clipOnly && !isCLIPSensor(&sensors[i]) {
+			continue
+		}
+		out = append(out, sensorToMap(&sensors[i]))
+	}
+	return map[string]interface{}{"sensors": out}, nil
+}
+
+func (s *HueDiscover) createSensor(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "create_sensor")
+	if err != nil {
+		return nil, err
+	}
+	name, _ := spec["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("create_sensor needs a name")
+	}
+	sensorType, _ := spec["type"].(string)
+	if sensorType == "" {
+		sensorType = "CLIPGenericStatus"
+	}
+	if !strings.HasPrefix(sensorType, "CLIP") {
+		return nil, fmt.Errorf("only CLIP sensors can be created, got type %q", sensorType)
+	}
+
+	sensor := &huego.Sensor{
+		Name:             name,
+		Type:             sensorType,
+		ModelID:          "viam-" + strings.ToLower(strings.TrimPrefix(sensorType, "CLIP")),
+		ManufacturerName: "viam",
+		SwVersion:        "1.0",
+		UniqueID:         fmt.Sprintf("viam-%d", time.Now().UnixNano()),
+	}
+	if v, ok := spec["state"].(map[string]interface{}); ok {
+		sensor.State = v
+	}
+	if v, ok := spec["config"].(map[string]interface{}); ok {
+		sensor.Config = v
+	}
+
+	if isDryRun(spec) {
+		return map[string]interface{}{"dry_run": true, "create": sensorToMap(sensor)}, nil
+	}
+
+	resp, err := s.bridge.CreateSensorContext(ctx, sensor)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create sensor: %w", err)
+	}
+	idStr, _ := resp.Success["id"].(string)
+	if sensor.ID, err = strconv.Atoi(idStr); err != nil {
+		return nil, fmt.Errorf("bridge returned unexpected sensor id %v", resp.Success["id"])
+	}
+	return map[string]interface{}{"sensor": sensorToMap(sensor)}, nil
+}
+
+// getCLIPSensor fetches a sensor and refuses physical ones, which this module
+// should never rename, reconfigure or delete.
+func (s *HueDiscover) getCLIPSensor(ctx context.Context, id int) (*huego.Sensor, error) {
+	sensor, err := s.bridge.GetSensorContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get sensor %d: %w", id, err)
+	}
+	sensor.ID = id
+	if !isCLIPSensor(sensor) {
+		return nil, fmt.Errorf("sensor %d is a %s, only CLIP sensors can be modified", id, sensor.Type)
+	}
+	return sensor, nil
+}
+
+func (s *HueDiscover) updateSensor(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "update_sensor")
+	if err != nil {
+		return nil, err
+	}
+	id, err := intArg(spec["id"])
+	if err != nil {
+		return nil, fmt.Errorf("update_sensor needs an id: %w", err)
+	}
+	current, err := s.getCLIPSensor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := spec["name"].(string)
+	state, _ := spec["state"].(map[string]interface{})
+	config, _ := spec["config"].(map[string]interface{})
+
+	after := *current
+	if name != "" {
+		after.Name = name
+	}
+	after.State = mergeMaps(current.State, state)
+	after.Config = mergeMaps(current.Config, config)
+
+	if isDryRun(spec) {
+		return map[string]interface{}{"dry_run": true, "before": sensorToMap(current), "after": sensorToMap(&after)}, nil
+	}
+
+	if name != "" {
+		if _, err := s.bridge.UpdateSensorContext(ctx, id, &huego.Sensor{Name: name}); err != nil {
+			return nil, fmt.Errorf("cannot rename sensor %d: %w", id, err)
+		}
+	}
+	if len(config) > 0 {
+		if _, err := s.bridge.UpdateSensorConfigContext(ctx, id, config); err != nil {
+			return nil, fmt.Errorf("cannot update config of sensor %d: %w", id, err)
+		}
+	}
+	if len(state) > 0 {
+		if err := putV1(ctx, s.bridge, fmt.Sprintf("/sensors/%d/state", id), state); err != nil {
+			return nil, fmt.Errorf("cannot update state of sensor %d: %w", id, err)
+		}
+	}
+	return map[string]interface{}{"sensor": sensorToMap(&after)}, nil
+}
+
+func (s *HueDiscover) deleteSensor(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	id, dryRun, err := idAndDryRun(arg, "delete_sensor")
+	if err != nil {
+		return nil, err
+	}
+	sensor, err := s.getCLIPSensor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return map[string]interface{}{"dry_run": true, "delete": sensorToMap(sensor)}, nil
+	}
+	if err := s.bridge.DeleteSensorContext(ctx, id); err != nil {
+		return nil, fmt.Errorf("cannot delete sensor %d: %w", id, err)
+	}
+	return map[string]interface{}{"deleted": sensorToMap(sensor)}, nil
+}
+
+// mergeMaps returns a copy of base with every key of overlay applied on top.
+func mergeMaps(base, overlay map[string]interface{}) map[string]interface{} {
+	if len(overlay) == 0 {
+		return base
+	}
+	out := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		out[k] = v
+	}
+	return out
+}
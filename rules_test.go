@@ -0,0 +1,129 @@
+package hue
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func testInventory() *bridgeInventory {
+	return &bridgeInventory{
+		lights:    map[int]bool{1: true},
+		groups:    map[int]bool{0: true, 2: true},
+		sensors:   map[int]bool{9: true},
+		schedules: map[int]bool{3: true},
+		scenes:    map[string]bool{"abc": true},
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	s := &HueDiscover{cfg: &DiscoveryConfig{Username: "user"}}
+	tests := []struct {
+		name    string
+		cond    map[string]interface{}
+		wantErr string
+		want    string // value of the parsed condition
+	}{
+		{"button event", map[string]interface{}{"address": "/sensors/9/state/buttonevent", "operator": "eq", "value": 1002.0}, "", "1002"},
+		{"username prefix", map[string]interface{}{"address": "/api/user/sensors/9/state/lastupdated", "operator": "dx"}, "", ""},
+		{"bool value", map[string]interface{}{"address": "/lights/1/state/on", "operator": "eq", "value": true}, "", "true"},
+		{"localtime", map[string]interface{}{"address": "/config/localtime", "operator": "in", "value": "T22:00:00/T06:00:00"}, "", "T22:00:00/T06:00:00"},
+		{"localtime eq", map[string]interface{}{"address": "/config/localtime", "operator": "eq", "value": "x"}, "only supports", ""},
+		{"unknown sensor", map[string]interface{}{"address": "/sensors/8/state/presence", "operator": "eq", "value": true}, "sensor 8 does not exist", ""},
+		{"bad address", map[string]interface{}{"address": "/config/name", "operator": "eq", "value": "x"}, "unsupported condition address", ""},
+		{"bad operator", map[string]interface{}{"address": "/lights/1/state/on", "operator": "neq", "value": true}, "unsupported condition operator", ""},
+		{"missing value", map[string]interface{}{"address": "/lights/1/state/bri", "operator": "gt"}, "needs a value", ""},
+		{"extra value", map[string]interface{}{"address": "/lights/1/state/bri", "operator": "dx", "value": 1.0}, "takes no value", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := s.parseCondition(testInventory(), tt.cond)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(cond.Address, "/api/") {
+				t.Errorf("address %q keeps the username prefix", cond.Address)
+			}
+			if cond.Value != tt.want {
+				t.Errorf("value = %q, want %q", cond.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRuleAction(t *testing.T) {
+	s := &HueDiscover{cfg: &DiscoveryConfig{Username: "user"}}
+	body := map[string]interface{}{"on": true}
+	tests := []struct {
+		name       string
+		action     map[string]interface{}
+		wantErr    string
+		wantMethod string
+	}{
+		{"light state", map[string]interface{}{"address": "/lights/1/state", "body": body}, "", "PUT"},
+		{"all lights", map[string]interface{}{"address": "/groups/0/action", "body": body}, "", "PUT"},
+		{"sensor state", map[string]interface{}{"address": "/sensors/9/state", "method": "put", "body": map[string]interface{}{"status": 1}}, "", "PUT"},
+		{"delete schedule", map[string]interface{}{"address": "/schedules/3", "method": "DELETE"}, "", "DELETE"},
+		{"unknown group", map[string]interface{}{"address": "/groups/5/action", "body": body}, "group 5 does not exist", ""},
+		{"unknown scene", map[string]interface{}{"address": "/scenes/xyz/lightstates/1", "body": body}, "scene xyz does not exist", ""},
+		{"bad address", map[string]interface{}{"address": "/lights/1", "body": body}, "unsupported action address", ""},
+		{"no body", map[string]interface{}{"address": "/lights/1/state"}, "needs an object body", ""},
+		{"bad method", map[string]interface{}{"address": "/lights/1/state", "method": "GET", "body": body}, "unsupported method", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := s.parseRuleAction(testInventory(), tt.action)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Method != tt.wantMethod {
+				t.Errorf("method = %q, want %q", action.Method, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestCreateRuleDryRun(t *testing.T) {
+	f := newFakeBridge(t)
+	f.addLight(1, nil)
+	for _, path := range []string{"/schedules", "/scenes"} {
+		f.routes["GET "+path] = map[string]interface{}{}
+	}
+	f.routes["GET /sensors"] = map[string]interface{}{"9": map[string]interface{}{"name": "switch", "type": "ZLLSwitch"}}
+	s := &HueDiscover{cfg: &DiscoveryConfig{Username: "user"}, bridge: f.Bridge}
+
+	spec := map[string]interface{}{
+		"name":       "dimmer on",
+		"conditions": []interface{}{map[string]interface{}{"address": "/sensors/9/state/buttonevent", "operator": "eq", "value": "1002"}},
+		"actions":    []interface{}{map[string]interface{}{"address": "/lights/1/state", "body": map[string]interface{}{"on": true}}},
+		"dry_run":    true,
+	}
+	got, err := s.DoCommand(context.Background(), map[string]interface{}{"create_rule": spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["dry_run"] != true || got["create"] == nil {
+		t.Errorf("dry run returned %v", got)
+	}
+	if w := f.writes("/"); len(w) != 0 {
+		t.Errorf("dry run wrote %v", w)
+	}
+
+	spec["actions"] = []interface{}{}
+	if _, err := s.DoCommand(context.Background(), map[string]interface{}{"create_rule": spec}); err == nil ||
+		!strings.Contains(err.Error(), "1-8 actions") {
+		t.Errorf("err = %v, want a rule without actions rejected", err)
+	}
+}
@@ -0,0 +1,130 @@
+package hue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"go.viam.com/rdk/logging"
+)
+
+// job is a long-running light animation, such as an effect or a routine, that
+// a jobRunner drives in the background.
+type job interface {
+	// category groups jobs for the stop and status commands, e.g. "effect".
+	category() string
+	// name is the specific kind of job, e.g. "candle" or "sunrise".
+	name() string
+	lightIDs() []int
+	// timeout bounds how long the job may run; 0 lets it run until it returns
+	// or is stopped.
+	timeout() time.Duration
+	run(ctx context.Context, bridge *huego.Bridge, logger logging.Logger)
+	// status reports job-specific progress.
+	status() map[string]interface{}
+}
+
+// jobRunner runs at most one job at a time in a background goroutine.
+type jobRunner struct {
+	claim *claimant // owner of the jobs' writes
+
+	mu      sync.Mutex
+	current job
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// start stops any running job and starts j. onFinish, if set, runs in the job
+// goroutine once j ends, whether it completed, timed out or was stopped.
+func (r *jobRunner) start(bridge *huego.Bridge, j job, logger logging.Logger, onFinish func()) {
+	r.stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t := j.timeout(); t > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), t)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	ctx = withClaimant(ctx, r.claim)
+	done := make(chan struct{})
+	r.current, r.cancel, r.done = j, cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		if onFinish != nil {
+			defer onFinish()
+		}
+		j.run(ctx, bridge, logger)
+	}()
+}
+
+// stop cancels the running job, if any, waits for it to finish, and returns it.
+func (r *jobRunner) stop() job {
+	r.mu.Lock()
+	j, cancel, done := r.current, r.cancel, r.done
+	r.current, r.cancel, r.done = nil, nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return j
+}
+
+// stopCategory stops the running job only if it belongs to category.
+func (r *jobRunner) stopCategory(category string) job {
+	if j := r.running(); j == nil || j.category() != category {
+		return nil
+	}
+	return r.stop()
+}
+
+// running returns the job that is still running, or nil.
+func (r *jobRunner) running() job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done == nil {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return nil
+	default:
+		return r.current
+	}
+}
+
+// jobStatus describes the current job of a category for DoCommand results.
+// A job that finished on its own is still reported, with running false, until
+// another job replaces it.
+func (r *jobRunner) jobStatus(category string) map[string]interface{} {
+	r.mu.Lock()
+	j, done := r.current, r.done
+	r.mu.Unlock()
+	if j == nil || j.category() != category {
+		return map[string]interface{}{"running": false}
+	}
+	running := true
+	select {
+	case <-done:
+		running = false
+	default:
+	}
+	out := map[string]interface{}{
+		"running": running,
+		"type":    j.name(),
+		"lights":  intsToInterfaces(j.lightIDs()),
+	}
+	for k, v := range j.status() {
+		out[k] = v
+	}
+	return out
+}
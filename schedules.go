@@ -0,0 +1,382 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amimof/huego"
+)
+
+// Bridge schedules run on the bridge itself, so they fire even when the Viam
+// machine is offline. They are managed through DoCommand on hue-discovery:
+//
+//	{"list_schedules": true}
+//	{"create_schedule": {...spec}}
+//	{"update_schedule": {"id": 3, ...spec}}
+//	{"enable_schedule": 3}
+//	{"disable_schedule": 3}
+//	{"delete_schedule": 3}
+//
+// A spec has "name", "description", "localtime" (or "time" plus optional
+// "days" and "randomize"), a "target" of {"light": id}, {"group": id} or
+// {"scene": id, "group": id}, the "state" to send, "enabled" and "autodelete".
+
+const hueTime = `\d{2}:\d{2}:\d{2}`
+
+// reLocalTime matches the bridge's localtime formats: absolute, recurring
+// weekly, one-shot timer and recurring timer, each optionally randomized.
+var reLocalTime = regexp.MustCompile(`^(` +
+	`\d{4}-\d{2}-\d{2}T` + hueTime +
+	`|W(\d{1,3})/T` + hueTime +
+	`|PT` + hueTime +
+	`|R\d{0,2}/PT` + hueTime +
+	`)(A` + hueTime + `)?$`)
+
+var reTimeOfDay = regexp.MustCompile(`^` + hueTime + `$`)
+
+// weekdayBits are the bridge's recurrence bitmask values, Monday first.
+var weekdayBits = map[string]int{
+	"mon": 64, "tue": 32, "wed": 16, "thu": 8, "fri": 4, "sat": 2, "sun": 1,
+	"weekdays": 124, "weekend": 3, "daily": 127,
+}
+
+// stateKeys are the light/group state attributes a schedule command may carry.
+var stateKeys = map[string]bool{
+	"on": true, "bri": true, "hue": true, "sat": true, "xy": true, "ct": true,
+	"alert": true, "effect": true, "transitiontime": true, "scene": true,
+	"bri_inc": true, "sat_inc": true, "hue_inc": true, "ct_inc": true, "xy_inc": true,
+}
+
+func validateLocalTime(localtime string) error {
+	m := reLocalTime.FindStringSubmatch(localtime)
+	if m == nil {
+		return fmt.Errorf("invalid localtime %q", localtime)
+	}
+	if m[2] != "" {
+		bits, _ := strconv.Atoi(m[2])
+		if bits < 1 || bits > 127 {
+			return fmt.Errorf("invalid weekday bitmask %d in localtime %q, must be 1-127", bits, localtime)
+		}
+	}
+	return nil
+}
+
+// buildLocalTime assembles a recurring localtime string from "time", "days" and
+// "randomize", e.g. {"time": "07:00:00", "days": ["weekdays"]} -> W124/T07:00:00.
+func buildLocalTime(spec map[string]interface{}) (string, error) {
+	t, _ := spec["time"].(string)
+	if !reTimeOfDay.MatchString(t) {
+		return "", fmt.Errorf("time must be hh:mm:ss, got %q", t)
+	}
+
+	bits := 0
+	switch days := spec["days"].(type) {
+	case nil:
+		bits = weekdayBits["daily"]
+	case []interface{}:
+		for _, d := range days {
+			name, _ := d.(string)
+			b, ok := weekdayBits[strings.ToLower(name)]
+			if !ok {
+				return "", fmt.Errorf("unknown day %v", d)
+			}
+			bits |= b
+		}
+	default:
+		return "", fmt.Errorf("days must be a list of day names")
+	}
+
+	localtime := fmt.Sprintf("W%d/T%s", bits, t)
+	if r, ok := spec["randomize"].(string); ok {
+		if !reTimeOfDay.MatchString(r) {
+			return "", fmt.Errorf("randomize must be hh:mm:ss, got %q", r)
+		}
+		localtime += "A" + r
+	}
+	return localtime, nil
+}
+
+// scheduleCommand builds the bridge command for a target and state, checking
+// that the targeted light, group or scene exists.
+func (s *HueDiscover) scheduleCommand(ctx context.Context, target, state map[string]interface{}) (*huego.Command, error) {
+	body := map[string]interface{}{}
+	for k, v := range state {
+		if !stateKeys[k] {
+			return nil, fmt.Errorf("unsupported state attribute %q", k)
+		}
+		body[k] = v
+	}
+
+	if v, ok := target["light"]; ok {
+		id, err := intArg(v)
+		if err != nil {
+			return nil, fmt.Errorf("target light: %w", err)
+		}
+		if _, err := s.bridge.GetLightContext(ctx, id); err != nil {
+			return nil, fmt.Errorf("target light %d: %w", id, err)
+		}
+		if len(body) == 0 {
+			return nil, fmt.Errorf("a light target needs a state")
+		}
+		return &huego.Command{
+			Address: fmt.Sprintf("/api/%s/lights/%d/state", s.cfg.Username, id),
+			Method:  http.MethodPut,
+			Body:    body,
+		}, nil
+	}
+
+	group := 0
+	if v, ok := target["group"]; ok {
+		id, err := intArg(v)
+		if err != nil {
+			return nil, fmt.Errorf("target group: %w", err)
+		}
+		if id != 0 {
+			if _, err := s.bridge.GetGroupContext(ctx, id); err != nil {
+				return nil, fmt.Errorf("target group %d: %w", id, err)
+			}
+		}
+		group = id
+	}
+
+	if v, ok := target["scene"]; ok {
+		sceneID, _ := v.(string)
+		if sceneID == "" {
+			return nil, fmt.Errorf("target scene must be a scene id string")
+		}
+		if _, err := s.bridge.GetSceneContext(ctx, sceneID); err != nil {
+			return nil, fmt.Errorf("target scene %s: %w", sceneID, err)
+		}
+		body["scene"] = sceneID
+	} else if _, ok := target["group"]; !ok {
+		return nil, fmt.Errorf("target needs a \"light\", \"group\", or \"scene\"")
+	}
+
+	if len(body) == 0 {
+		return nil, fmt.Errorf("a group target needs a state")
+	}
+	return &huego.Command{
+		Address: fmt.Sprintf("/api/%s/groups/%d/action", s.cfg.Username, group),
+		Method:  http.MethodPut,
+		Body:    body,
+	}, nil
+}
+
+// applyScheduleSpec overlays the fields present in spec onto sched.
+func (s *HueDiscover) applyScheduleSpec(ctx context.Context, sched *huego.Schedule, spec map[string]interface{}) error {
+	if v, ok := spec["name"].(string); ok {
+		sched.Name = v
+	}
+	if v, ok := spec["description"].(string); ok {
+		sched.Description = v
+	}
+
+	if v, ok := spec["localtime"].(string); ok {
+		if err := validateLocalTime(v); err != nil {
+			return err
+		}
+		sched.LocalTime = v
+	} else if _, ok := spec["time"]; ok {
+		localtime, err := buildLocalTime(spec)
+		if err != nil {
+			return err
+		}
+		sched.LocalTime = localtime
+	}
+
+	_, hasTarget := spec["target"]
+	_, hasState := spec["state"]
+	if hasTarget || hasState {
+		target, err := mapArg(spec["target"], "target")
+		if err != nil {
+			return err
+		}
+		state := map[string]interface{}{}
+		if hasState {
+			if state, err = mapArg(spec["state"], "state"); err != nil {
+				return err
+			}
+		}
+		cmd, err := s.scheduleCommand(ctx, target, state)
+		if err != nil {
+			return err
+		}
+		sched.Command = cmd
+	}
+
+	if v, ok := spec["enabled"].(bool); ok {
+		sched.Status = scheduleStatus(v)
+	}
+	if v, ok := spec["autodelete"].(bool); ok {
+		sched.AutoDelete = v
+	}
+	return nil
+}
+
+func scheduleStatus(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func scheduleToMap(sched *huego.Schedule) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":          sched.ID,
+		"name":        sched.Name,
+		"description": sched.Description,
+		"localtime":   sched.LocalTime,
+		"status":      sched.Status,
+		"autodelete":  sched.AutoDelete,
+	}
+	if sched.StartTime != "" {
+		out["starttime"] = sched.StartTime
+	}
+	if sched.Command != nil {
+		out["command"] = map[string]interface{}{
+			"address": sched.Command.Address,
+			"method":  sched.Command.Method,
+			"body":    sched.Command.Body,
+		}
+	}
+	return out
+}
+
+func (s *HueDiscover) listSchedules(ctx context.Context, _ interface{}) (map[string]interface{}, error) {
+	schedules, err := s.bridge.GetSchedulesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schedules: %w", err)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+
+	out := make([]interface{}, len(schedules))
+	for i, sched := range schedules {
+		out[i] = scheduleToMap(sched)
+	}
+	return map[string]interface{}{"schedules": out}, nil
+}
+
+func (s *HueDiscover) createSchedule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "create_schedule")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := spec["target"]; !ok {
+		return nil, fmt.Errorf("create_schedule needs a target")
+	}
+	_, hasLocal := spec["localtime"]
+	_, hasTime := spec["time"]
+	if !hasLocal && !hasTime {
+		return nil, fmt.Errorf("create_schedule needs a localtime or time")
+	}
+
+	sched := &huego.Schedule{Status: "enabled"}
+	if err := s.applyScheduleSpec(ctx, sched, spec); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.bridge.CreateScheduleContext(ctx, sched)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create schedule: %w", err)
+	}
+	idStr, _ := resp.Success["id"].(string)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("bridge returned unexpected schedule id %v", resp.Success["id"])
+	}
+	sched.ID = id
+	if err := s.clearAutoDelete(ctx, id, spec); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"schedule": scheduleToMap(sched)}, nil
+}
+
+// clearAutoDelete sends "autodelete": false when spec sets it explicitly.
+// huego drops a false autodelete via omitempty, so it is sent on its own.
+func (s *HueDiscover) clearAutoDelete(ctx context.Context, id int, spec map[string]interface{}) error {
+	if v, ok := spec["autodelete"].(bool); !ok || v {
+		return nil
+	}
+	if err := putV1(ctx, s.bridge, fmt.Sprintf("/schedules/%d", id), map[string]interface{}{"autodelete": false}); err != nil {
+		return fmt.Errorf("cannot update autodelete of schedule %d: %w", id, err)
+	}
+	return nil
+}
+
+// updateSchedule merges the given fields into the existing schedule. huego
+// sends every non-omitempty field, so the full current schedule is read first
+// to avoid blanking the name, command or localtime.
+func (s *HueDiscover) updateSchedule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	spec, err := mapArg(arg, "update_schedule")
+	if err != nil {
+		return nil, err
+	}
+	id, err := intArg(spec["id"])
+	if err != nil {
+		return nil, fmt.Errorf("update_schedule needs an id: %w", err)
+	}
+	result, err := s.modifySchedule(ctx, id, func(sched *huego.Schedule) error {
+		return s.applyScheduleSpec(ctx, sched, spec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.clearAutoDelete(ctx, id, spec); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *HueDiscover) enableSchedule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	return s.setScheduleEnabled(ctx, arg, true)
+}
+
+func (s *HueDiscover) disableSchedule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	return s.setScheduleEnabled(ctx, arg, false)
+}
+
+func (s *HueDiscover) setScheduleEnabled(ctx context.Context, arg interface{}, enabled bool) (map[string]interface{}, error) {
+	id, err := intArg(arg)
+	if err != nil {
+		return nil, fmt.Errorf("schedule id: %w", err)
+	}
+	return s.modifySchedule(ctx, id, func(sched *huego.Schedule) error {
+		sched.Status = scheduleStatus(enabled)
+		return nil
+	})
+}
+
+func (s *HueDiscover) modifySchedule(ctx context.Context, id int, modify func(*huego.Schedule) error) (map[string]interface{}, error) {
+	sched, err := s.bridge.GetScheduleContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schedule %d: %w", id, err)
+	}
+	if err := modify(sched); err != nil {
+		return nil, err
+	}
+
+	// time and starttime are derived by the bridge and rejected on write.
+	update := *sched
+	update.Time = ""
+	update.StartTime = ""
+	if _, err := s.bridge.UpdateScheduleContext(ctx, id, &update); err != nil {
+		return nil, fmt.Errorf("cannot update schedule %d: %w", id, err)
+	}
+	return map[string]interface{}{"schedule": scheduleToMap(sched)}, nil
+}
+
+func (s *HueDiscover) deleteSchedule(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	id, err := intArg(arg)
+	if err != nil {
+		return nil, fmt.Errorf("schedule id: %w", err)
+	}
+	if err := s.bridge.DeleteScheduleContext(ctx, id); err != nil {
+		return nil, fmt.Errorf("cannot delete schedule %d: %w", id, err)
+	}
+	return map[string]interface{}{"deleted": id}, nil
+}
@@ -0,0 +1,109 @@
+package hue
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBuildLocalTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		want    string
+		wantErr string
+	}{
+		{"daily", map[string]interface{}{"time": "07:00:00"}, "W127/T07:00:00", ""},
+		{"weekdays", map[string]interface{}{"time": "07:00:00", "days": []interface{}{"weekdays"}}, "W124/T07:00:00", ""},
+		{"days combine", map[string]interface{}{"time": "22:30:00", "days": []interface{}{"Sat", "sun", "mon"}}, "W67/T22:30:00", ""},
+		{"randomized", map[string]interface{}{"time": "07:00:00", "randomize": "00:15:00"}, "W127/T07:00:00A00:15:00", ""},
+		{"short time", map[string]interface{}{"time": "7:00"}, "", "time must be hh:mm:ss"},
+		{"unknown day", map[string]interface{}{"time": "07:00:00", "days": []interface{}{"someday"}}, "", "unknown day"},
+		{"days not a list", map[string]interface{}{"time": "07:00:00", "days": "mon"}, "", "days must be a list"},
+		{"bad randomize", map[string]interface{}{"time": "07:00:00", "randomize": "soon"}, "", "randomize must be hh:mm:ss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildLocalTime(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("buildLocalTime = %q, want %q", got, tt.want)
+			}
+			if err := validateLocalTime(got); err != nil {
+				t.Errorf("built localtime does not validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateLocalTime(t *testing.T) {
+	tests := []struct {
+		localtime string
+		ok        bool
+	}{
+		{"2026-10-18T07:00:00", true},
+		{"W124/T07:00:00", true},
+		{"PT00:10:00", true},
+		{"R03/PT00:01:00", true},
+		{"W127/T07:00:00A00:30:00", true},
+		{"W0/T07:00:00", false},
+		{"W128/T07:00:00", false},
+		{"07:00:00", false},
+		{"tomorrow", false},
+	}
+	for _, tt := range tests {
+		if err := validateLocalTime(tt.localtime); (err == nil) != tt.ok {
+			t.Errorf("validateLocalTime(%q) = %v, want ok %v", tt.localtime, err, tt.ok)
+		}
+	}
+}
+
+func TestScheduleAutoDelete(t *testing.T) {
+	existing := map[string]interface{}{
+		"name": "wake", "localtime": "W124/T07:00:00", "status": "enabled", "autodelete": false,
+		"command": map[string]interface{}{"address": "/api/user/groups/0/action", "method": "PUT", "body": map[string]interface{}{"on": true}},
+	}
+	tests := []struct {
+		name  string
+		cmd   map[string]interface{}
+		clear bool // whether "autodelete": false is sent
+	}{
+		{"create without autodelete", map[string]interface{}{"create_schedule": map[string]interface{}{
+			"localtime": "PT00:10:00", "target": map[string]interface{}{"light": 1}, "state": map[string]interface{}{"on": false}}}, false},
+		{"create keeping the schedule", map[string]interface{}{"create_schedule": map[string]interface{}{
+			"localtime": "PT00:10:00", "target": map[string]interface{}{"light": 1}, "state": map[string]interface{}{"on": false}, "autodelete": false}}, true},
+		{"update name only", map[string]interface{}{"update_schedule": map[string]interface{}{"id": 3, "name": "wake up"}}, false},
+		{"update autodelete true", map[string]interface{}{"update_schedule": map[string]interface{}{"id": 3, "autodelete": true}}, false},
+		{"update autodelete false", map[string]interface{}{"update_schedule": map[string]interface{}{"id": 3, "autodelete": false}}, true},
+		{"disable", map[string]interface{}{"disable_schedule": 3}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, nil)
+			f.routes["GET /schedules/3"] = existing
+			f.routes["POST /schedules"] = []map[string]interface{}{{"success": map[string]interface{}{"id": "3"}}}
+			s := &HueDiscover{cfg: &DiscoveryConfig{Username: "user"}, bridge: f.Bridge}
+			if _, err := s.DoCommand(context.Background(), tt.cmd); err != nil {
+				t.Fatal(err)
+			}
+			cleared := false
+			for _, w := range f.writes("/schedules/3") {
+				if len(w.body) == 1 && w.body["autodelete"] == false {
+					cleared = true
+				}
+			}
+			if cleared != tt.clear {
+				t.Errorf("sent autodelete false = %v, want %v", cleared, tt.clear)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/amimof/huego"
+)
+
+// stepKeys are the relative changes the bridge applies itself, so a caller can
+// ask for "brighter" or "warmer" without reading the light first.
+var stepKeys = []string{"bri_inc", "ct_inc", "hue_inc", "sat_inc", "xy_inc"}
+
+// stepLimits is the largest increment the bridge accepts for each step key.
+var stepLimits = map[string]float64{
+	"bri_inc": 254,
+	"ct_inc":  65534,
+	"hue_inc": 65534,
+	"sat_inc": 254,
+	"xy_inc":  0.5, // per coordinate
+}
+
+// hasStep reports whether a DoCommand asks for a relative change.
+func hasStep(cmd map[string]interface{}) bool {
+	for _, k := range stepKeys {
+		if _, ok := cmd[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stepBody builds the bridge body for the step keys in cmd, clamping each
+// increment to the range the bridge accepts. A positive bri_inc also turns
+// the light on, since the bridge rejects changes to a light that is off.
+func stepBody(cmd map[string]interface{}) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	for _, k := range stepKeys {
+		v, ok := cmd[k]
+		if !ok {
+			continue
+		}
+		limit := stepLimits[k]
+		if k == "xy_inc" {
+			var xy []float64
+			if err := decodeArg(v, &xy); err != nil || len(xy) != 2 {
+				return nil, fmt.Errorf("xy_inc must be [dx, dy], got %v", v)
+			}
+			body[k] = []interface{}{clampStep(xy[0], limit), clampStep(xy[1], limit)}
+			continue
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a number, got %v", k, v)
+		}
+		body[k] = int(math.Round(clampStep(f, limit)))
+	}
+	if inc, _ := body["bri_inc"].(int); inc > 0 {
+		body["on"] = true
+	}
+	return body, nil
+}
+
+// dimsOnly reports whether a step body only lowers brightness, which quiet
+// hours never block.
+func dimsOnly(body map[string]interface{}) bool {
+	inc, ok := body["bri_inc"].(int)
+	return ok && inc < 0 && len(body) == 1
+}
+
+func clampStep(v, limit float64) float64 {
+	return math.Max(-limit, math.Min(limit, v))
+}
+
+// sendStep sends a step body to a light state or group action path.
+func sendStep(ctx context.Context, bridge *huego.Bridge, path string, body map[string]interface{}, transitionMs int) error {
+	out := make(map[string]interface{}, len(body)+1)
+	for k, v := range body {
+		out[k] = v
+	}
+	if transitionMs >= 0 {
+		out["transitiontime"] = min(transitionMs/100, math.MaxUint16)
+	}
+	return putV1(ctx, bridge, path, out)
+}
+
+// sendLightStep applies a relative change to one light, waiting for the
+// bridge rate limit.
+// The bridge computes the result, so a light with limits is read back and
+// corrected if the change took it past them.
+func sendLightStep(ctx context.Context, bridge *huego.Bridge, id int, body map[string]interface{}, transitionMs int) error {
+	if err := claimantFrom(ctx).check(bridge, id); err != nil {
+		return err
+	}
+	if !dimsOnly(body) {
+		if _, err := applyLimits(bridge, id, huego.State{On: true}); err != nil {
+			return err // blocked by quiet hours
+		}
+	}
+	if err := waitForBridge(ctx, bridge); err != nil {
+		return err
+	}
+	if err := sendStep(ctx, bridge, fmt.Sprintf("/lights/%d/state", id), body, transitionMs); err != nil {
+		return err
+	}
+	forgetCommand(bridge, id) // the new value is only known to the bridge
+	if !hasLimits(bridge, []int{id}) {
+		return nil
+	}
+
+	light, err := bridge.GetLightContext(ctx, id)
+	if err != nil || light.State == nil {
+		return err
+	}
+	got := commandFromState(light.State)
+	if want := limitedState(bridge, id, got); !reflect.DeepEqual(want, got) {
+		return setLightState(ctx, bridge, id, got, transitionMs)
+	}
+	return nil
+}
+
+// stepLight applies a relative change to one light and returns its new state.
+func stepLight(ctx context.Context, bridge *huego.Bridge, id int, body map[string]interface{}, transitionMs int) (*huego.State, error) {
+	if err := sendLightStep(ctx, bridge, id, body, transitionMs); err != nil {
+		return nil, err
+	}
+	light, err := bridge.GetLightContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get light state: %w", err)
+	}
+	return light.State, nil
+}
+
+// commandFromState returns a command that would put a light into a state read
+// from the bridge, e.g. to remember the result of a relative change.
+func commandFromState(st *huego.State) huego.State {
+	cmd := huego.State{On: st.On, Bri: st.Bri}
+	switch st.ColorMode {
+	case "ct":
+		cmd.Ct = st.Ct
+	case "xy":
+		cmd.Xy = st.Xy
+	case "hs":
+		cmd.Hue, cmd.Sat = st.Hue, st.Sat
+	}
+	return cmd
+}
@@ -0,0 +1,50 @@
+package hue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStepBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{"brighter turns on", map[string]interface{}{"bri_inc": 25.0},
+			map[string]interface{}{"bri_inc": 25, "on": true}, false},
+		{"dimmer", map[string]interface{}{"bri_inc": -25.0},
+			map[string]interface{}{"bri_inc": -25}, false},
+		{"rounded", map[string]interface{}{"ct_inc": 10.6},
+			map[string]interface{}{"ct_inc": 11}, false},
+		{"clamped", map[string]interface{}{"bri_inc": 1000.0, "sat_inc": -1000.0},
+			map[string]interface{}{"bri_inc": 254, "sat_inc": -254, "on": true}, false},
+		{"hue", map[string]interface{}{"hue_inc": 70000.0},
+			map[string]interface{}{"hue_inc": 65534}, false},
+		{"xy", map[string]interface{}{"xy_inc": []interface{}{0.1, -0.7}},
+			map[string]interface{}{"xy_inc": []interface{}{0.1, -0.5}}, false},
+		{"other keys ignored", map[string]interface{}{"ct_inc": 5.0, "lights": []interface{}{1.0}},
+			map[string]interface{}{"ct_inc": 5}, false},
+		{"not a number", map[string]interface{}{"bri_inc": "up"}, nil, true},
+		{"xy wrong length", map[string]interface{}{"xy_inc": []interface{}{0.1}}, nil, true},
+		{"xy not a list", map[string]interface{}{"xy_inc": 0.1}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stepBody(tt.cmd)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("stepBody(%v) = %v, want an error", tt.cmd, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stepBody(%v) = %v, want %v", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
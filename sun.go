@@ -0,0 +1,54 @@
+package hue
+
+import (
+	"math"
+	"time"
+)
+
+// j2000 is the epoch the sunrise equation counts days from.
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+const (
+	earthObliquity = 23.4397 // degrees
+	sunsetAltitude = -0.833  // degrees; accounts for refraction and the sun's radius
+)
+
+func rad(deg float64) float64 { return deg * math.Pi / 180 }
+func deg(rad float64) float64 { return rad * 180 / math.Pi }
+
+// sunTimes returns sunrise and sunset on the calendar day of t, for a location
+// in degrees with north and east positive. It uses the standard sunrise
+// equation, which is good to a minute or two and needs no network. During
+// polar day the sun rises 12 hours before solar noon and sets 12 hours after;
+// during polar night both are at solar noon.
+func sunTimes(t time.Time, lat, lon float64) (rise, set time.Time) {
+	y, m, d := t.Date()
+	n := math.Round(time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Sub(j2000).Hours() / 24)
+
+	meanSolarTime := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	ma := rad(anomaly)
+	center := 1.9148*math.Sin(ma) + 0.02*math.Sin(2*ma) + 0.0003*math.Sin(3*ma)
+	eclipticLon := rad(math.Mod(anomaly+center+180+102.9372, 360))
+	transit := meanSolarTime + 0.0053*math.Sin(ma) - 0.0069*math.Sin(2*eclipticLon)
+
+	sinDecl := math.Sin(eclipticLon) * math.Sin(rad(earthObliquity))
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	cosHourAngle := (math.Sin(rad(sunsetAltitude)) - math.Sin(rad(lat))*sinDecl) / (math.Cos(rad(lat)) * cosDecl)
+	hourAngle := deg(math.Acos(math.Max(-1, math.Min(1, cosHourAngle))))
+
+	days := func(jd float64) time.Time {
+		return j2000.Add(time.Duration(jd * 24 * float64(time.Hour))).In(t.Location())
+	}
+	return days(transit - hourAngle/360), days(transit + hourAngle/360)
+}
+
+// sunFactor is 0 while the sun is down and rises along a sine to 1 at solar
+// noon, so light follows the sun's height rather than the clock.
+func sunFactor(t time.Time, lat, lon float64) float64 {
+	rise, set := sunTimes(t, lat, lon)
+	if !t.After(rise) || !t.Before(set) {
+		return 0
+	}
+	return math.Sin(math.Pi * float64(t.Sub(rise)) / float64(set.Sub(rise)))
+}
@@ -0,0 +1,77 @@
+package hue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunTimes(t *testing.T) {
+	nyc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name      string
+		day       time.Time
+		lat, lon  float64
+		rise, set string // local HH:MM, within a few minutes
+	}{
+		{"new york summer solstice", time.Date(2024, 6, 21, 12, 0, 0, 0, nyc), 40.7128, -74.0060, "05:25", "20:31"},
+		{"new york winter solstice", time.Date(2024, 12, 21, 12, 0, 0, 0, nyc), 40.7128, -74.0060, "07:17", "16:32"},
+		{"equator equinox", time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC), 0, 0, "06:04", "18:11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rise, set := sunTimes(tt.day, tt.lat, tt.lon)
+			for _, c := range []struct {
+				got  time.Time
+				want string
+			}{{rise, tt.rise}, {set, tt.set}} {
+				clock, _ := time.ParseInLocation("15:04", c.want, tt.day.Location())
+				y, m, d := tt.day.Date()
+				want := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, tt.day.Location())
+				if diff := c.got.Sub(want).Abs(); diff > 5*time.Minute {
+					t.Errorf("got %s, want about %s", c.got.Format("15:04"), c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSunTimesPolar(t *testing.T) {
+	// Tromsø: midnight sun in June, polar night in December
+	rise, set := sunTimes(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC), 69.65, 18.96)
+	if d := set.Sub(rise); d < 23*time.Hour {
+		t.Errorf("polar day lasts %v, want 24h", d)
+	}
+	rise, set = sunTimes(time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC), 69.65, 18.96)
+	if d := set.Sub(rise); d > time.Minute {
+		t.Errorf("polar night lasts %v of daylight, want none", d)
+	}
+}
+
+func TestSunFactor(t *testing.T) {
+	const lat, lon = 0.0, 0.0
+	day := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	rise, set := sunTimes(day, lat, lon)
+	noon := rise.Add(set.Sub(rise) / 2)
+	tests := []struct {
+		name     string
+		at       time.Time
+		min, max float64
+	}{
+		{"midnight", day, 0, 0},
+		{"sunrise", rise, 0, 0},
+		{"morning", rise.Add(set.Sub(rise) / 4), 0.6, 0.8},
+		{"solar noon", noon, 0.999, 1},
+		{"sunset", set, 0, 0},
+		{"night", set.Add(time.Hour), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if f := sunFactor(tt.at, lat, lon); f < tt.min || f > tt.max {
+				t.Errorf("sunFactor = %v, want %v-%v", f, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package hue
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
 	"github.com/amimof/huego"
 	"go.viam.com/rdk/logging"
+	"golang.org/x/time/rate"
 )
 
 // connectToLight resolves the bridge host (discovering it if empty), connects to
@@ -27,3 +37,281 @@ func connectToLight(bridgeHost, username string, lightID int, logger logging.Log
 
 	return bridge, light, nil
 }
+
+// intArg converts a numeric DoCommand argument to an int. Values arrive from
+// JSON/protobuf as float64, but plain ints are accepted for Go callers.
+func intArg(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case float64:
+		if n != float64(int(n)) {
+			return 0, fmt.Errorf("expected an integer, got %v", n)
+		}
+		return int(n), nil
+	case int:
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %v", v)
+}
+
+// mapArg asserts that a DoCommand argument is an object.
+func mapArg(v interface{}, command string) (map[string]interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s expects an object argument", command)
+	}
+	return m, nil
+}
+
+// intsToInterfaces converts IDs for use in DoCommand and Readings results,
+// which only accept generic slices.
+func intsToInterfaces(ids []int) []interface{} {
+	out := make([]interface{}, len(ids))
+	for i, id := range ids {
+		out[i] = id
+	}
+	return out
+}
+
+// decodeArg converts a DoCommand argument into a config struct by way of its
+// JSON tags.
+func decodeArg(v, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// putV1 sends a raw v1 PUT to path (relative to /api/<username>) for requests
+// huego cannot express, such as CLIP sensor state or a zero transition time.
+func putV1(ctx context.Context, bridge *huego.Bridge, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	host := bridge.Host
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	url := fmt.Sprintf("%s/api/%s%s", strings.TrimSuffix(host, "/"), bridge.User, path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return fmt.Errorf("unexpected response from bridge: %s", raw)
+	}
+	for _, r := range results {
+		if e, ok := r["error"].(map[string]interface{}); ok {
+			return fmt.Errorf("bridge error: %v", e["description"])
+		}
+	}
+	return nil
+}
+
+// transitionDefault leaves the fade time to the bridge (400 ms).
+const transitionDefault = -1
+
+// maxCommonCt is the warmest color temperature every Hue white ambiance light
+// accepts. Some bulbs clamp warmer values, so they read back differently.
+const maxCommonCt = 454
+
+// maxTransitionMs is the longest fade the bridge accepts, in its 100 ms units.
+const maxTransitionMs = math.MaxUint16 * 100
+
+func validateTransitionMs(ms int) error {
+	if ms < 0 || ms > maxTransitionMs {
+		return fmt.Errorf("transition_ms must be 0-%d, got %d", maxTransitionMs, ms)
+	}
+	return nil
+}
+
+// transitionArg returns the fade time for one SetPosition call: transition_ms
+// from extra when given, else the configured default, else the bridge default.
+func transitionArg(extra map[string]interface{}, configured *int) (int, error) {
+	if v, ok := extra["transition_ms"]; ok {
+		ms, err := intArg(v)
+		if err != nil {
+			return 0, fmt.Errorf("transition_ms: %w", err)
+		}
+		if err := validateTransitionMs(ms); err != nil {
+			return 0, err
+		}
+		return ms, nil
+	}
+	if configured != nil {
+		return *configured, nil
+	}
+	return transitionDefault, nil
+}
+
+// setLightState sends state to a light, waiting for the bridge rate limit.
+// transitionMs overrides state.TransitionTime when it is not transitionDefault.
+// The light's limits are applied first and may change or block the state.
+func setLightState(ctx context.Context, bridge *huego.Bridge, id int, state huego.State, transitionMs int) error {
+	if err := claimantFrom(ctx).check(bridge, id); err != nil {
+		return err
+	}
+	state, err := applyLimits(bridge, id, state)
+	if err != nil {
+		return err
+	}
+	if err := waitForBridge(ctx, bridge); err != nil {
+		return err
+	}
+	if err := sendState(ctx, bridge, fmt.Sprintf("/lights/%d/state", id), state, transitionMs, func(st huego.State) error {
+		_, err := bridge.SetLightStateContext(ctx, id, st)
+		return err
+	}); err != nil {
+		return err
+	}
+	recordCommand(bridge, id, state, transitionMs)
+	return nil
+}
+
+// setLightLevels is setLightState for a light that is already on. "on" is
+// left out of the write, so a light switched off since it was read is not
+// turned back on.
+func setLightLevels(ctx context.Context, bridge *huego.Bridge, id int, state huego.State, transitionMs int) error {
+	state.On = true
+	if err := claimantFrom(ctx).check(bridge, id); err != nil {
+		return err
+	}
+	state, err := applyLimits(bridge, id, state)
+	if err != nil {
+		return err
+	}
+	if err := waitForBridge(ctx, bridge); err != nil {
+		return err
+	}
+	body, err := stateBody(state, transitionMs)
+	if err != nil {
+		return err
+	}
+	delete(body, "on")
+	if err := putV1(ctx, bridge, fmt.Sprintf("/lights/%d/state", id), body); err != nil {
+		return err
+	}
+	recordCommand(bridge, id, state, transitionMs)
+	return nil
+}
+
+// setGroupState sends state to every light in a bridge group with a single
+// action, so they all change at the same moment. lights are the group's
+// members; nothing is sent if any of them is held by another owner. Group
+// actions have a much lower rate limit than light commands.
+func setGroupState(ctx context.Context, bridge *huego.Bridge, id int, lights []int, state huego.State, transitionMs int) error {
+	for _, light := range lights {
+		if err := claimantFrom(ctx).check(bridge, light); err != nil {
+			return err
+		}
+	}
+	if err := waitForBridgeGroups(ctx, bridge); err != nil {
+		return err
+	}
+	if err := sendState(ctx, bridge, fmt.Sprintf("/groups/%d/action", id), state, transitionMs, func(st huego.State) error {
+		_, err := bridge.SetGroupStateContext(ctx, id, st)
+		return err
+	}); err != nil {
+		return err
+	}
+	for _, light := range lights {
+		recordCommand(bridge, light, state, transitionMs)
+	}
+	return nil
+}
+
+// sendState applies transitionMs to state and sends it with send. huego drops
+// a zero transition time via omitempty, so instant changes are re-encoded and
+// PUT to path with an explicit "transitiontime": 0.
+func sendState(ctx context.Context, bridge *huego.Bridge, path string, state huego.State, transitionMs int, send func(huego.State) error) error {
+	if transitionMs < 0 {
+		return send(state)
+	}
+	state.TransitionTime = uint16(min(transitionMs/100, math.MaxUint16))
+	if state.TransitionTime > 0 {
+		return send(state)
+	}
+
+	body, err := stateBody(state, 0)
+	if err != nil {
+		return err
+	}
+	return putV1(ctx, bridge, path, body)
+}
+
+// stateBody encodes state as a raw v1 body with transitionMs applied, keeping
+// a zero transition time that huego would drop.
+func stateBody(state huego.State, transitionMs int) (map[string]interface{}, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	if transitionMs >= 0 {
+		body["transitiontime"] = min(transitionMs/100, math.MaxUint16)
+	}
+	return body, nil
+}
+
+// The bridge handles roughly ten light commands per second before it starts
+// dropping or queueing them, and about one group action per second, so writes
+// that can come in bursts share limiters per bridge.
+const (
+	bridgeCommandsPerSecond = 10
+	bridgeCommandBurst      = 10
+
+	bridgeGroupActionsPerSecond = 1
+	bridgeGroupActionBurst      = 3
+)
+
+var (
+	bridgeLimitersMu sync.Mutex
+	bridgeLimiters   = map[string]*rate.Limiter{}
+)
+
+// bridgeLimiter returns the shared limiter for one kind of command on a bridge.
+func bridgeLimiter(bridge *huego.Bridge, kind string, perSecond float64, burst int) *rate.Limiter {
+	key := bridgeKey(bridge) + "/" + kind
+
+	bridgeLimitersMu.Lock()
+	defer bridgeLimitersMu.Unlock()
+	limiter, ok := bridgeLimiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(perSecond), burst)
+		bridgeLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// bridgeKey identifies a bridge for state shared between components.
+func bridgeKey(bridge *huego.Bridge) string {
+	return strings.TrimPrefix(strings.TrimPrefix(bridge.Host, "http://"), "https://")
+}
+
+// waitForBridge blocks until the bridge's rate limit allows another command.
+func waitForBridge(ctx context.Context, bridge *huego.Bridge) error {
+	return bridgeLimiter(bridge, "lights", bridgeCommandsPerSecond, bridgeCommandBurst).Wait(ctx)
+}
+
+// waitForBridgeGroups blocks until the bridge's rate limit allows another
+// group action.
+func waitForBridgeGroups(ctx context.Context, bridge *huego.Bridge) error {
+	return bridgeLimiter(bridge, "groups", bridgeGroupActionsPerSecond, bridgeGroupActionBurst).Wait(ctx)
+}
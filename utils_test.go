@@ -0,0 +1,245 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+// fakeRequest is a write the fake bridge received.
+type fakeRequest struct {
+	method string
+	path   string // below /api/<user>, e.g. "/lights/1/state"
+	body   map[string]interface{}
+}
+
+// fakeBridge serves the parts of the v1 API the module uses. Lights keep the
+// state written to them; other paths answer from routes, or with success.
+type fakeBridge struct {
+	*huego.Bridge
+	server *httptest.Server
+
+	mu       sync.Mutex
+	lights   map[int]map[string]interface{} // light ID -> state
+	groups   map[int]map[string]interface{} // group ID -> group
+	routes   map[string]interface{}         // "GET /path" -> response
+	requests []fakeRequest
+}
+
+func newFakeBridge(t *testing.T) *fakeBridge {
+	f := &fakeBridge{
+		lights: map[int]map[string]interface{}{},
+		groups: map[int]map[string]interface{}{},
+		routes: map[string]interface{}{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	f.Bridge = huego.New(f.server.URL, "user")
+	return f
+}
+
+// addLight adds a reachable color light with the given state fields.
+func (f *fakeBridge) addLight(id int, state map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := map[string]interface{}{"on": false, "bri": 254, "reachable": true, "colormode": "xy", "xy": []interface{}{0.3, 0.3}}
+	for k, v := range state {
+		st[k] = v
+	}
+	f.lights[id] = st
+}
+
+func (f *fakeBridge) state(id int) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]interface{}{}
+	for k, v := range f.lights[id] {
+		out[k] = v
+	}
+	return out
+}
+
+// writes returns the writes received so far to paths starting with prefix.
+func (f *fakeBridge) writes(prefix string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []fakeRequest
+	for _, r := range f.requests {
+		if strings.HasPrefix(r.path, prefix) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (f *fakeBridge) light(id int) map[string]interface{} {
+	return map[string]interface{}{
+		"state": f.lights[id], "type": "Extended color light", "name": "light " + strconv.Itoa(id),
+		"modelid": "LCT015", "uniqueid": strconv.Itoa(id),
+	}
+}
+
+func (f *fakeBridge) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/user")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	var body map[string]interface{}
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		json.Unmarshal(data, &body)
+	}
+	if r.Method != http.MethodGet {
+		f.requests = append(f.requests, fakeRequest{method: r.Method, path: path, body: body})
+	}
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	success := func() { reply([]map[string]interface{}{{"success": map[string]interface{}{path: true}}}) }
+
+	if resp, ok := f.routes[r.Method+" "+path]; ok {
+		reply(resp)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && path == "/lights":
+		out := map[string]interface{}{}
+		for id := range f.lights {
+			out[strconv.Itoa(id)] = f.light(id)
+		}
+		reply(out)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "lights":
+		id, _ := strconv.Atoi(parts[1])
+		reply(f.light(id))
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[0] == "lights" && parts[2] == "state":
+		id, _ := strconv.Atoi(parts[1])
+		f.setState(f.lights[id], body)
+		success()
+	case r.Method == http.MethodGet && path == "/groups":
+		out := map[string]interface{}{}
+		for id, g := range f.groups {
+			out[strconv.Itoa(id)] = g
+		}
+		reply(out)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "groups":
+		id, _ := strconv.Atoi(parts[1])
+		reply(f.groups[id])
+	case r.Method == http.MethodPost && path == "/groups":
+		id := len(f.groups) + 1
+		for f.groups[id] != nil {
+			id++
+		}
+		f.groups[id] = body
+		reply([]map[string]interface{}{{"success": map[string]interface{}{"id": strconv.Itoa(id)}}})
+	case r.Method == http.MethodDelete && len(parts) == 2 && parts[0] == "groups":
+		id, _ := strconv.Atoi(parts[1])
+		delete(f.groups, id)
+		success()
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[0] == "groups" && parts[2] == "action":
+		id, _ := strconv.Atoi(parts[1])
+		if g := f.groups[id]; g != nil {
+			ids, _ := g["lights"].([]interface{})
+			for _, l := range ids {
+				lid, _ := strconv.Atoi(l.(string))
+				if f.lights[lid] != nil {
+					f.setState(f.lights[lid], body)
+				}
+			}
+		}
+		success()
+	default:
+		success()
+	}
+}
+
+// setState applies a write to a light's state the way the bridge does,
+// including the color mode it implies.
+func (f *fakeBridge) setState(st, body map[string]interface{}) {
+	for k, v := range body {
+		switch k {
+		case "transitiontime":
+		case "ct", "xy":
+			st["colormode"] = k
+			st[k] = v
+		case "hue", "sat":
+			st["colormode"] = "hs"
+			st[k] = v
+		default:
+			st[k] = v
+		}
+	}
+}
+
+func TestTransitionArg(t *testing.T) {
+	configured := 1500
+	tests := []struct {
+		name       string
+		extra      map[string]interface{}
+		configured *int
+		want       int
+		wantErr    bool
+	}{
+		{"bridge default", nil, nil, transitionDefault, false},
+		{"configured", nil, &configured, 1500, false},
+		{"extra wins", map[string]interface{}{"transition_ms": 0.0}, &configured, 0, false},
+		{"extra", map[string]interface{}{"transition_ms": 2000.0}, nil, 2000, false},
+		{"negative", map[string]interface{}{"transition_ms": -100.0}, nil, 0, true},
+		{"too long", map[string]interface{}{"transition_ms": float64(maxTransitionMs + 100)}, nil, 0, true},
+		{"not a number", map[string]interface{}{"transition_ms": "slow"}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transitionArg(tt.extra, tt.configured)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("transitionArg = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("transitionArg = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLightStateTransition(t *testing.T) {
+	tests := []struct {
+		name         string
+		transitionMs int
+		want         interface{} // transitiontime sent, nil when left out
+	}{
+		{"bridge default", transitionDefault, nil},
+		{"instant", 0, 0.0},
+		{"rounded down", 250, 2.0},
+		{"fade", 3000, 30.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeBridge(t)
+			f.addLight(1, nil)
+			if err := setLightState(context.Background(), f.Bridge, 1, huego.State{On: true, Bri: 100}, tt.transitionMs); err != nil {
+				t.Fatal(err)
+			}
+			writes := f.writes("/lights/1/state")
+			if len(writes) != 1 {
+				t.Fatalf("got %d writes, want 1", len(writes))
+			}
+			if got, ok := writes[0].body["transitiontime"]; got != tt.want || ok != (tt.want != nil) {
+				t.Errorf("transitiontime = %v, want %v", got, tt.want)
+			}
+			if f.state(1)["bri"] != 100.0 {
+				t.Errorf("light state %v, want bri 100", f.state(1))
+			}
+		})
+	}
+}